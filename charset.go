@@ -0,0 +1,71 @@
+package gsyslog
+
+import (
+	"github.com/crazy-airhead/gsyslog/charset"
+	"github.com/crazy-airhead/gsyslog/parser"
+)
+
+// charsets picks the charset of the logs of a source, to transcode them to UTF-8
+type charsets struct {
+	charset  *charset.Charset
+	sources  sources[*charset.Charset]
+	detector charset.Detector
+}
+
+// SetCharset Sets the charset the logs of the listeners without their own
+// charset are sent in, e.g. charset.GBK. The hostname, tag, content and message
+// are transcoded to UTF-8 before being handled, the Body is kept as is.
+func (s *Server) SetCharset(c *charset.Charset) {
+	s.charsets.charset = c
+}
+
+// SetSourceCharset Sets the charset the logs of source are sent in, whatever
+// the listener. source is an IP or a CIDR, the longest matching one is used.
+func (s *Server) SetSourceCharset(source string, c *charset.Charset) error {
+	return s.charsets.sources.set(source, c)
+}
+
+// SetCharsetDetector Sets the detector guessing the charset of the logs of the
+// sources and listeners without a charset, e.g.
+// charset.NewDetector(charset.GB18030, charset.Big5)
+func (s *Server) SetCharsetDetector(d charset.Detector) {
+	s.charsets.detector = d
+}
+
+// SetCharset Sets the charset the logs of the listener are sent in, see
+// Server.SetCharset
+func (l *Listener) SetCharset(c *charset.Charset) {
+	l.charset = c
+}
+
+// transcode transcodes log to UTF-8 from the charset of client
+func (l *Listener) transcode(log *parser.Log, client string) {
+	c := l.server.charsets.get(l, client, log.Body)
+	if c == nil {
+		return
+	}
+
+	// the fields that can not be decoded are kept as is
+	_ = charset.Transcode(log, c)
+}
+
+// get returns the charset of client on l, nil when unknown
+func (c *charsets) get(l *Listener, client string, body []byte) *charset.Charset {
+	if cs, ok := c.sources.lookup(client); ok {
+		return cs
+	}
+
+	if l.charset != nil {
+		return l.charset
+	}
+
+	if c.charset != nil {
+		return c.charset
+	}
+
+	if c.detector != nil {
+		return c.detector.Detect(body)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package charset
+
+import (
+	"bytes"
+	"github.com/crazy-airhead/gsyslog/parser"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"strings"
+	"unicode/utf8"
+)
+
+// Charset is the character set a sender encodes its logs in
+type Charset struct {
+	name string
+	// encoding is nil for UTF-8
+	encoding encoding.Encoding
+}
+
+var (
+	UTF8    = &Charset{name: "UTF-8"}
+	GBK     = &Charset{name: "GBK", encoding: simplifiedchinese.GBK}
+	GB18030 = &Charset{name: "GB18030", encoding: simplifiedchinese.GB18030}
+	Big5    = &Charset{name: "Big5", encoding: traditionalchinese.Big5}
+	Latin1  = &Charset{name: "ISO-8859-1", encoding: charmap.ISO8859_1}
+
+	// names the charsets by their lower case names and aliases
+	names = map[string]*Charset{
+		"utf-8":      UTF8,
+		"utf8":       UTF8,
+		"gbk":        GBK,
+		"cp936":      GBK,
+		"gb2312":     GBK,
+		"gb18030":    GB18030,
+		"big5":       Big5,
+		"big5-hkscs": Big5,
+		"iso-8859-1": Latin1,
+		"iso8859-1":  Latin1,
+		"latin1":     Latin1,
+	}
+
+	// transcoded the fields of a Log that are transcoded, see Transcode
+	transcoded = []string{"hostname", "tag", "content", "message"}
+)
+
+// Lookup returns the charset named name, e.g. "gbk" or "latin1", the case is ignored
+func Lookup(name string) (*Charset, bool) {
+	c, ok := names[strings.ToLower(name)]
+	return c, ok
+}
+
+func (c *Charset) String() string {
+	return c.name
+}
+
+// Decode returns b decoded to UTF-8, b itself for UTF-8 and ASCII. An invalid
+// sequence is decoded to U+FFFD.
+func (c *Charset) Decode(b []byte) ([]byte, error) {
+	if c.encoding == nil || isASCII(b) {
+		return b, nil
+	}
+
+	return c.encoding.NewDecoder().Bytes(b)
+}
+
+// Transcode decodes the hostname, tag, content and message of log from c to
+// UTF-8, the Body is kept as is. The message of a log declaring UTF-8 with the
+// BOM is kept too. The CEF or LEEF event of the content or the message is
+// parsed again from the UTF-8, see parser.ReparsePayload.
+func Transcode(log *parser.Log, c *Charset) error {
+	if c == nil || c.encoding == nil {
+		return nil
+	}
+
+	for _, key := range transcoded {
+		if key == "message" && log.Syslog.UTF8 {
+			continue
+		}
+
+		b := log.GetBytes(key)
+		if isASCII(b) {
+			continue
+		}
+
+		decoded, err := c.Decode(b)
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case "hostname":
+			log.SetHostnameBytes(decoded)
+		case "tag":
+			log.SetTagBytes(decoded)
+		case "content":
+			log.SetContentBytes(decoded)
+			parser.ReparsePayload(log, decoded)
+		case "message":
+			log.SetMessageBytes(decoded)
+			parser.ReparsePayload(log, decoded)
+		}
+	}
+
+	return nil
+}
+
+// Detector guesses the charset of a log
+type Detector interface {
+	// Detect returns the charset of b, nil when unknown
+	Detect(b []byte) *Charset
+}
+
+// DetectorFunc is a func used as a Detector
+type DetectorFunc func(b []byte) *Charset
+
+func (f DetectorFunc) Detect(b []byte) *Charset {
+	return f(b)
+}
+
+// NewDetector returns a heuristic Detector: a log that is valid UTF-8 is UTF-8,
+// any other log is in the candidate decoding it with the fewest invalid
+// sequences, the first one on a tie
+func NewDetector(candidates ...*Charset) Detector {
+	return DetectorFunc(func(b []byte) *Charset {
+		if utf8.Valid(b) {
+			return UTF8
+		}
+
+		var detected *Charset
+		fewest := -1
+		for _, c := range candidates {
+			decoded, err := c.Decode(b)
+			if err != nil {
+				continue
+			}
+
+			invalid := bytes.Count(decoded, []byte(string(utf8.RuneError)))
+			if fewest < 0 || invalid < fewest {
+				detected = c
+				fewest = invalid
+			}
+		}
+
+		return detected
+	})
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,156 @@
+package charset
+
+import (
+	"github.com/crazy-airhead/gsyslog/parser"
+	"github.com/crazy-airhead/gsyslog/parser/rfc3164"
+	"github.com/crazy-airhead/gsyslog/parser/rfc5424"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hooks up gocheck into the gotest runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type CharsetTestSuite struct {
+}
+
+var _ = Suite(&CharsetTestSuite{})
+
+func (s *CharsetTestSuite) TestLookup(c *C) {
+	for name, expected := range map[string]*Charset{
+		"GBK":        GBK,
+		"gb18030":    GB18030,
+		"Big5":       Big5,
+		"latin1":     Latin1,
+		"ISO-8859-1": Latin1,
+		"utf-8":      UTF8,
+	} {
+		obtained, ok := Lookup(name)
+		c.Assert(ok, Equals, true)
+		c.Assert(obtained, Equals, expected)
+	}
+
+	_, ok := Lookup("ebcdic")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *CharsetTestSuite) TestDecode(c *C) {
+	fixtures := []struct {
+		charset  *Charset
+		encoded  string
+		expected string
+	}{
+		{GBK, "\xc4\xe3\xba\xc3", "你好"},
+		{GB18030, "\x95\x32\x82\x36", "𠀀"},
+		{Big5, "\xa7\x41\xa6\x6e", "你好"},
+		{Latin1, "caf\xe9", "café"},
+		{UTF8, "你好", "你好"},
+		{GBK, "ascii", "ascii"},
+	}
+
+	for _, fixture := range fixtures {
+		decoded, err := fixture.charset.Decode([]byte(fixture.encoded))
+		c.Assert(err, IsNil)
+		c.Assert(string(decoded), Equals, fixture.expected, Commentf("charset %s", fixture.charset))
+	}
+}
+
+func (s *CharsetTestSuite) TestTranscode(c *C) {
+	// hostname 主机, tag 程序 and content 你好 in GBK
+	body := []byte("<34>Oct 11 22:14:15 \xd6\xf7\xbb\xfa \xb3\xcc\xd0\xf2: \xc4\xe3\xba\xc3")
+
+	log, err := rfc3164.NewParser().Parse(body, "192.0.2.1:514")
+	c.Assert(err, IsNil)
+	c.Assert(Transcode(log, GBK), IsNil)
+
+	c.Assert(log.GetString("hostname"), Equals, "主机")
+	c.Assert(log.GetString("tag"), Equals, "程序")
+	c.Assert(log.GetString("content"), Equals, "你好")
+	c.Assert(*log.Syslog.Hostname, Equals, "主机")
+	c.Assert(log.Syslog.Message, Equals, "你好")
+	c.Assert(string(log.Body), Equals, string(body))
+
+	// a pooled log
+	log = parser.AcquireLog(body)
+	c.Assert(rfc3164.NewParser().ParseLog(log, "192.0.2.1:514"), IsNil)
+	c.Assert(Transcode(log, GBK), IsNil)
+	c.Assert(log.GetString("content"), Equals, "你好")
+
+	log.Materialize()
+	c.Assert(log.Header["tag"], Equals, "程序")
+	parser.ReleaseLog(log)
+}
+
+func (s *CharsetTestSuite) TestTranscode_CEF(c *C) {
+	// vendor 厂商, product 防火墙 and msg 你好 世界 in GBK
+	body := []byte("<134>Oct 11 22:14:15 host CEF:0|\xb3\xa7\xc9\xcc|\xb7\xc0\xbb\xf0\xc7\xbd|1.0|100|name|5|" +
+		"msg=\xc4\xe3\xba\xc3\x20\xca\xc0\xbd\xe7 suser=\xd3\xc3\xbb\xa7")
+
+	log, err := rfc3164.NewParser().Parse(body, "192.0.2.1:514")
+	c.Assert(err, IsNil)
+	c.Assert(Transcode(log, GBK), IsNil)
+	c.Assert(log.Warnings, HasLen, 0)
+	c.Assert(log.Syslog.CEF, NotNil)
+	c.Assert(log.Syslog.CEF.DeviceVendor, Equals, "厂商")
+	c.Assert(log.Syslog.CEF.DeviceProduct, Equals, "防火墙")
+	c.Assert(log.Syslog.CEF.Extension, DeepEquals, parser.Attributes{
+		{Key: "msg", Value: "你好 世界"},
+		{Key: "suser", Value: "用户"},
+	})
+
+	// 許 is \xb3\x5c in Big5, its second byte escapes the pipe that follows
+	body = []byte("<134>1 - host app - - - CEF:0|V|P|1.0|100|\xb3\x5c|5|act=\xb3\x5c\xa5\x69")
+
+	log, err = rfc5424.NewParser().Parse(body, "192.0.2.1:514")
+	c.Assert(err, IsNil)
+	c.Assert(log.Syslog.CEF, IsNil)
+	c.Assert(log.Warnings, HasLen, 1)
+
+	c.Assert(Transcode(log, Big5), IsNil)
+	c.Assert(log.Warnings, HasLen, 0)
+	c.Assert(log.Syslog.CEF, NotNil)
+	c.Assert(log.Syslog.CEF.Name, Equals, "許")
+	c.Assert(log.Syslog.CEF.Severity, Equals, "5")
+	c.Assert(log.Syslog.CEF.Extension, DeepEquals, parser.Attributes{{Key: "act", Value: "許可"}})
+}
+
+func (s *CharsetTestSuite) TestTranscode_LEEF(c *C) {
+	// product 防火墙 and usr 用户 in GBK
+	body := []byte("<134>Oct 11 22:14:15 host LEEF:2.0|V|\xb7\xc0\xbb\xf0\xc7\xbd|1.0|100|^|usr=\xd3\xc3\xbb\xa7^msg=\xc4\xe3\xba\xc3")
+
+	log, err := rfc3164.NewParser().Parse(body, "192.0.2.1:514")
+	c.Assert(err, IsNil)
+	c.Assert(Transcode(log, GBK), IsNil)
+	c.Assert(log.Warnings, HasLen, 0)
+	c.Assert(log.Syslog.LEEF, NotNil)
+	c.Assert(log.Syslog.LEEF.Product, Equals, "防火墙")
+	c.Assert(log.Syslog.LEEF.Attributes, DeepEquals, parser.Attributes{
+		{Key: "usr", Value: "用户"},
+		{Key: "msg", Value: "你好"},
+	})
+
+	// 許 is \xb3\x5c in Big5, its second byte escapes the pipe that follows
+	body = []byte("<134>1 - host app - - - LEEF:1.0|V|\xb3\x5c|1.0|100|act=\xa5\xe1")
+
+	log, err = rfc5424.NewParser().Parse(body, "192.0.2.1:514")
+	c.Assert(err, IsNil)
+	c.Assert(log.Syslog.LEEF, IsNil)
+	c.Assert(log.Warnings, HasLen, 1)
+
+	c.Assert(Transcode(log, Big5), IsNil)
+	c.Assert(log.Warnings, HasLen, 0)
+	c.Assert(log.Syslog.LEEF, NotNil)
+	c.Assert(log.Syslog.LEEF.Product, Equals, "許")
+	c.Assert(log.Syslog.LEEF.Attributes, DeepEquals, parser.Attributes{{Key: "act", Value: "丟"}})
+}
+
+func (s *CharsetTestSuite) TestDetector(c *C) {
+	detector := NewDetector(GB18030, Big5, Latin1)
+
+	c.Assert(detector.Detect([]byte("你好 ascii")), Equals, UTF8)
+	c.Assert(detector.Detect([]byte("\xc4\xe3\xba\xc3")), Equals, GB18030)
+	c.Assert(detector.Detect([]byte("caf\xe9")), Equals, Latin1)
+
+	c.Assert(NewDetector().Detect([]byte("caf\xe9")), IsNil)
+}
@@ -0,0 +1,165 @@
+package gsyslog
+
+import (
+	"context"
+	"github.com/crazy-airhead/gsyslog/charset"
+	"testing"
+)
+
+func Test_charset(t *testing.T) {
+	handler := &cloneHandler{}
+	server := NewServer()
+	server.SetHandler(handler)
+	server.SetCodec(RFC3164Codec)
+	server.SetOrdering(OrderPerSource)
+	server.SetCharsetDetector(charset.NewDetector(charset.GB18030, charset.Latin1))
+
+	if err := server.SetSourceCharset("192.0.2.0/24", charset.GBK); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.SetSourceCharset("invalid", charset.GBK); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	big5 := NewListener("udp://127.0.0.1:0")
+	big5.SetCharset(charset.Big5)
+	server.AddListener(big5)
+
+	detected := NewListener("udp://127.0.0.1:0")
+	server.AddListener(detected)
+
+	fixtures := []struct {
+		listener *Listener
+		client   string
+		body     string
+		expected string
+	}{
+		// the charset of the source wins over the one of the listener
+		{big5, "192.0.2.1:514", "<34>Oct 11 22:14:15 host su: \xc4\xe3\xba\xc3", "你好"},
+		{big5, "198.51.100.1:514", "<34>Oct 11 22:14:15 host su: \xa7\x41\xa6\x6e", "你好"},
+		{detected, "198.51.100.1:514", "<34>Oct 11 22:14:15 host su: caf\xe9", "café"},
+		{detected, "198.51.100.1:514", "<34>Oct 11 22:14:15 host su: 你好", "你好"},
+	}
+
+	for _, fixture := range fixtures {
+		server.dispatch(&task{listener: fixture.listener, data: []byte(fixture.body), client: fixture.client})
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handler.logs) != len(fixtures) {
+		t.Fatalf("unexpected %d logs", len(handler.logs))
+	}
+
+	for _, fixture := range fixtures {
+		found := false
+		for _, log := range handler.logs {
+			if string(log.Body) == fixture.body {
+				found = true
+				if log.GetString("content") != fixture.expected {
+					t.Fatalf("unexpected content %q of %q", log.GetString("content"), fixture.body)
+				}
+			}
+		}
+
+		if !found {
+			t.Fatalf("log %q not handled", fixture.body)
+		}
+	}
+}
+
+func Test_sources(t *testing.T) {
+	var s sources[string]
+	for source, value := range map[string]string{
+		"192.0.2.0/24":  "net",
+		"192.0.2.1":     "host",
+		"0.0.0.0/0":     "any",
+		"2001:db8::/32": "v6",
+	} {
+		if err := s.set(source, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for client, expected := range map[string]string{
+		"192.0.2.1:514":        "host",
+		"192.0.2.2:514":        "net",
+		"[::ffff:192.0.2.2]:1": "net",
+		"198.51.100.1":         "any",
+		"[2001:db8::1]:514":    "v6",
+		"/dev/log":             "",
+	} {
+		if value, _ := s.lookup(client); value != expected {
+			t.Fatalf("unexpected %q for %s", value, client)
+		}
+	}
+
+	s.setHostname("FW01", "hostname")
+	for hostname, expected := range map[string]string{
+		"fw01": "hostname",
+		"FW01": "hostname",
+		"fw02": "",
+		"":     "",
+	} {
+		if value, _ := s.lookupHostname([]byte(hostname)); value != expected {
+			t.Fatalf("unexpected %q for %s", value, hostname)
+		}
+	}
+}
+
+func Test_charset_payload(t *testing.T) {
+	handler := &cloneHandler{}
+	server := NewServer()
+	server.SetHandler(handler)
+	server.SetCodec(RFC3164Codec)
+	server.SetLogPooling(true)
+	server.SetAddr("udp://127.0.0.1:0")
+
+	if err := server.SetSourceCharset("192.0.2.0/24", charset.Big5); err != nil {
+		t.Fatal(err)
+	}
+
+	// 許 is \xb3\x5c in Big5, its second byte would escape the pipe or the
+	// equal sign that follows in the raw bytes
+	fixtures := []string{
+		"<134>Oct 11 22:14:15 host CEF:0|V|P|1.0|100|\xb3\x5c|5|act=\xb3\x5c=",
+		"<134>Oct 11 22:14:15 host LEEF:1.0|V|\xb3\x5c|1.0|100|act=\xb3\x5c\tusr=\xa5\xe1",
+	}
+
+	for _, body := range fixtures {
+		server.dispatch(&task{listener: server.listener, data: []byte(body), client: "192.0.2.1:514"})
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handler.logs) != len(fixtures) {
+		t.Fatalf("unexpected %d logs", len(handler.logs))
+	}
+
+	for _, log := range handler.logs {
+		if len(log.Warnings) != 0 {
+			t.Fatalf("unexpected warnings %v of %q", log.Warnings, log.Body)
+		}
+
+		switch {
+		case log.Syslog.CEF != nil:
+			cef := log.Syslog.CEF
+			if cef.Name != "許" || cef.Severity != "5" || len(cef.Extension) != 1 || cef.Extension[0].Value != "許=" {
+				t.Fatalf("unexpected CEF %+v", cef)
+			}
+		case log.Syslog.LEEF != nil:
+			leef := log.Syslog.LEEF
+			if leef.Product != "許" || leef.EventID != "100" || len(leef.Attributes) != 2 ||
+				leef.Attributes[0].Value != "許" || leef.Attributes[1].Value != "丟" {
+				t.Fatalf("unexpected LEEF %+v", leef)
+			}
+		default:
+			t.Fatalf("no event parsed from %q", log.Body)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"github.com/crazy-airhead/gsyslog/parser"
+	"github.com/crazy-airhead/gsyslog/parser/cisco"
 	"github.com/crazy-airhead/gsyslog/parser/rfc3164"
 	"github.com/crazy-airhead/gsyslog/parser/rfc5424"
 	"github.com/panjf2000/gnet/v2"
@@ -22,44 +23,151 @@ import (
  * codec, it would be best to select it explicitly.
  */
 
-type AutomaticCodec struct{}
+type AutomaticCodec struct {
+	// Trailer ends every frame of non-transparent framed streams, TrailerLF when nil
+	Trailer Trailer
+	// MaxFrameSize is the largest frame accepted, DefaultMaxFrameSize when zero
+	MaxFrameSize int
+	// Strict parses RFC5424 messages in rfc5424.Strict mode
+	Strict bool
+	// ReplaceInvalidUTF8 replaces the invalid UTF-8 sequences of RFC5424 MSG,
+	// see rfc5424.Parser.SetReplaceInvalidUTF8
+	ReplaceInvalidUTF8 bool
+	// RFC3164Parser parses the RFC3164 messages, e.g. with a tag length limit
+	// (rfc3164.Parser.SetMaxTagLen), a shared default parser when nil
+	RFC3164Parser *rfc3164.Parser
+	// RFC5424Parser parses the RFC5424 messages, e.g. with a custom mode, a
+	// shared parser set up from Strict and ReplaceInvalidUTF8 when nil
+	RFC5424Parser *rfc5424.Parser
+}
 
 const (
 	Unknown = iota
 	RFC3164 = iota
 	RFC5424 = iota
 	RFC6587 = iota
+	Cisco   = iota
 )
 
 var (
 	// 解析器
 	rfc3164Parser = rfc3164.NewParser() // RFC3164: http://www.ietf.org/rfc/rfc3164.txt
 	rfc5424Parser = rfc5424.NewParser() // RFC5424: http://www.ietf.org/rfc/rfc5424.txt
+	ciscoParser   = cisco.NewParser()   // Cisco IOS, NX-OS and ASA
 
 	// 错误
-	ErrIncompletePacket = errors.New("incomplete packet")
+	ErrIncompletePacket   = errors.New("incomplete packet")
+	ErrInvalidFrameLength = errors.New("invalid frame length")
+	ErrFrameTooLarge      = errors.New("frame too large")
 )
 
 func (c *AutomaticCodec) GetParser(line []byte) parser.Parser {
+	return getParser(line, c.RFC3164Parser, c.RFC5424Parser, rfc5424Options{c.Strict, c.ReplaceInvalidUTF8})
+}
+
+// getParser picks the parser for a single message, the configured parsers of
+// the codec when not nil
+func getParser(line []byte, p3164 *rfc3164.Parser, p5424 *rfc5424.Parser, options rfc5424Options) parser.Parser {
 	switch format := detect(line); format {
 	case RFC3164:
-		return rfc3164Parser
+		return getRfc3164Parser(p3164)
 	case RFC5424:
-		return rfc5424Parser
+		return getRfc5424Parser(p5424, options)
+	case Cisco:
+		return ciscoParser
 	default:
+		return getRfc3164Parser(p3164)
+	}
+}
+
+// getRfc3164Parser returns p, the shared parser when nil
+func getRfc3164Parser(p *rfc3164.Parser) parser.Parser {
+	if p == nil {
 		return rfc3164Parser
 	}
+
+	return p
+}
+
+// rfc5424Options the RFC5424 settings of a codec
+type rfc5424Options struct {
+	strict             bool
+	replaceInvalidUTF8 bool
+}
+
+// rfc5424Parsers the shared parser of every rfc5424Options
+var rfc5424Parsers = map[rfc5424Options]*rfc5424.Parser{
+	{}:                                       rfc5424Parser,
+	{strict: true}:                           newRfc5424Parser(rfc5424Options{strict: true}),
+	{replaceInvalidUTF8: true}:               newRfc5424Parser(rfc5424Options{replaceInvalidUTF8: true}),
+	{strict: true, replaceInvalidUTF8: true}: newRfc5424Parser(rfc5424Options{strict: true, replaceInvalidUTF8: true}),
+}
+
+func newRfc5424Parser(options rfc5424Options) *rfc5424.Parser {
+	p := rfc5424.NewParser()
+	if options.strict {
+		p.SetMode(rfc5424.Strict)
+	}
+
+	p.SetReplaceInvalidUTF8(options.replaceInvalidUTF8)
+	return p
 }
 
-// Decode 不需要实现，会调用具体的编码器的 Decode
+// getRfc5424Parser returns p, the shared parser of options when nil
+func getRfc5424Parser(p *rfc5424.Parser, options rfc5424Options) parser.Parser {
+	if p == nil {
+		return rfc5424Parsers[options]
+	}
+
+	return p
+}
+
+// Decode detects the framing from the first bytes of the connection, then keeps
+// using it for the lifetime of the connection
 func (c *AutomaticCodec) Decode(conn gnet.Conn) ([]byte, error) {
-	return nil, nil
+	fc := framingContext(conn)
+
+	framing := fc.Framing()
+	if framing == FramingUnknown {
+		buf, _ := conn.Peek(1)
+		if len(buf) == 0 {
+			return nil, ErrIncompletePacket
+		}
+
+		framing = detectFraming(buf[0])
+		fc.SetFraming(framing)
+	}
+
+	if framing == FramingOctetCounting {
+		return decodeOctetCounting(conn, c.MaxFrameSize)
+	}
+
+	return decodeNonTransparent(conn, c.Trailer, c.MaxFrameSize)
+}
+
+// detectFraming octet counting frames start with a MSG-LEN, RFC6587 s3.4.1,
+// while every syslog message starts with '<' or a month name
+func detectFraming(c byte) Framing {
+	if c >= '1' && c <= '9' {
+		return FramingOctetCounting
+	}
+
+	return FramingNonTransparent
 }
 
 /*
- * Will always fallback to rfc3164 (see section 4.3.3)
+ * Will always fallback to rfc3164 (see section 4.3.3), unless it is a Cisco message
  */
 func detect(data []byte) int {
+	format := detectSyslog(data)
+	if format == RFC3164 && cisco.Detect(data) {
+		return Cisco
+	}
+
+	return format
+}
+
+func detectSyslog(data []byte) int {
 	// all formats have a sapce somewhere
 	if i := bytes.IndexByte(data, ' '); i > 0 {
 		pLength := data[0:i]
@@ -0,0 +1,205 @@
+package codec
+
+import (
+	"errors"
+	"github.com/crazy-airhead/gsyslog/parser/cisco"
+	"github.com/crazy-airhead/gsyslog/parser/rfc3164"
+	"github.com/crazy-airhead/gsyslog/parser/rfc5424"
+	. "gopkg.in/check.v1"
+	"time"
+)
+
+type AutomaticTestSuite struct {
+}
+
+var _ = Suite(&AutomaticTestSuite{})
+
+func (s *AutomaticTestSuite) TestDecode(c *C) {
+	fixtures := []struct {
+		name   string
+		chunks []string
+		frames []string
+		err    error
+	}{
+		{
+			name:   "octet counting",
+			chunks: []string{"9 <34>1 a b", "7 <34>c d"},
+			frames: []string{"<34>1 a b", "<34>c d"},
+		},
+		{
+			name:   "octet counting frames contain newlines",
+			chunks: []string{"6 <34>\na", "3 b\nc"},
+			frames: []string{"<34>\na", "b\nc"},
+		},
+		{
+			name:   "non-transparent",
+			chunks: []string{"<34>1 a b\n<34>c", " d\n"},
+			frames: []string{"<34>1 a b", "<34>c d"},
+		},
+		{
+			name:   "non-transparent lines starting with digits",
+			chunks: []string{"<34>a\n", "12 b\n"},
+			frames: []string{"<34>a", "12 b"},
+		},
+		{
+			name:   "octet counting then garbage",
+			chunks: []string{"3 abc<34>d\n"},
+			frames: []string{"abc"},
+			err:    ErrInvalidFrameLength,
+		},
+	}
+
+	for _, f := range fixtures {
+		frames, err := feed(&AutomaticCodec{}, f.chunks)
+		c.Check(err, Equals, f.err, Commentf(f.name))
+		c.Check(frames, DeepEquals, f.frames, Commentf(f.name))
+	}
+}
+
+func (s *AutomaticTestSuite) TestDecode_FramingKeptInContext(c *C) {
+	codec := &AutomaticCodec{}
+
+	conn := &fakeConn{buf: []byte("3 abc")}
+	data, err := codec.Decode(conn)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "abc")
+	c.Assert(conn.Context(), DeepEquals, &ConnContext{framing: FramingOctetCounting})
+
+	shared := &ConnContext{}
+	shared.SetFraming(FramingNonTransparent)
+	conn = &fakeConn{buf: []byte("3 abc\n"), ctx: shared}
+	data, err = codec.Decode(conn)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "3 abc")
+	c.Assert(conn.Context(), Equals, shared)
+}
+
+func (s *AutomaticTestSuite) TestGetParser(c *C) {
+	codec := &AutomaticCodec{}
+
+	c.Assert(codec.GetParser([]byte("<34>1 2003-10-11T22:14:15.003Z host su - ID47 - msg")), FitsTypeOf, &rfc5424.Parser{})
+	c.Assert(codec.GetParser([]byte("<34>Oct 11 22:14:15 host su: msg")), FitsTypeOf, &rfc3164.Parser{})
+	c.Assert(codec.GetParser([]byte("no priority")), FitsTypeOf, &rfc3164.Parser{})
+
+	// the Cisco messages go to their own parser
+	for _, line := range []string{
+		"<189>123: *Mar  1 18:46:11.123 UTC: %LINK-3-UPDOWN: Interface Gi0/1, changed state to up",
+		"<189>: 2024 Mar  1 18:46:11 UTC: %ETHPORT-5-IF_UP: Interface Ethernet1/1 is up",
+		"<189>Mar  1 18:46:11.123 UTC: %SYS-5-CONFIG_I: Configured from console",
+		"<166>Mar 01 2024 18:46:11 asa01 : %ASA-6-302013: Built inbound TCP connection",
+	} {
+		c.Assert(codec.GetParser([]byte(line)), FitsTypeOf, &cisco.Parser{}, Commentf("line %s", line))
+	}
+	c.Assert(codec.GetParser([]byte("<34>Oct 11 22:14:15 host su: 100% done")), FitsTypeOf, &rfc3164.Parser{})
+
+	// the mnemonics of RFC3164 contents are left to rfc3164, and so are the
+	// Cisco messages without mnemonic
+	for _, line := range []string{
+		"<13>Mar  1 18:46:11 host app: %FOO-1-BAR: Interface Gi0/1",
+		"<13>%FOO-1-BAR: Interface Gi0/1",
+		"<189>125: *Mar  1 18:46:11 no mnemonic",
+	} {
+		c.Assert(codec.GetParser([]byte(line)), FitsTypeOf, &rfc3164.Parser{}, Commentf("line %s", line))
+	}
+
+	// a strict codec rejects what the lenient one only warns about
+	line := []byte("<34>1 2003-02-31T22:14:15.003Z host su - ID47 - msg")
+
+	_, err := codec.GetParser(line).Parse(line, "")
+	c.Assert(err, IsNil)
+
+	strict := &AutomaticCodec{Strict: true}
+	_, err = strict.GetParser(line).Parse(line, "")
+	c.Assert(errors.Is(err, rfc5424.ErrDayInvalid), Equals, true)
+
+	line = []byte("<34>1 - - - - - - caf\xe9")
+	replace := &AutomaticCodec{ReplaceInvalidUTF8: true}
+	log, err := replace.GetParser(line).Parse(line, "")
+	c.Assert(err, IsNil)
+	c.Assert(log.GetString("message"), Equals, "caf\uFFFD")
+}
+
+func (s *AutomaticTestSuite) TestGetParser_RFC3164Parser(c *C) {
+	line := []byte("<34>Oct 11 22:14:15 host very.large.syslog.message.tag.longer.than.32: msg")
+
+	p := rfc3164.NewParser()
+	p.SetMaxTagLen(rfc3164.MaxTagLen)
+
+	// the shared parser does not limit the tag
+	for _, codec := range []Codec{&AutomaticCodec{}, &NonTransparentCodec{}, &RFC3164Codec{}, &RFC6587Codec{}} {
+		log, err := codec.GetParser(line).Parse(line, "")
+		c.Assert(err, IsNil)
+		c.Assert(log.GetString("tag"), Equals, "very.large.syslog.message.tag.longer.than.32")
+	}
+
+	for _, codec := range []Codec{
+		&AutomaticCodec{RFC3164Parser: p},
+		&NonTransparentCodec{RFC3164Parser: p},
+		&RFC3164Codec{RFC3164Parser: p},
+		&RFC6587Codec{RFC3164Parser: p},
+	} {
+		log, err := codec.GetParser(line).Parse(line, "")
+		c.Assert(err, IsNil)
+		c.Assert(log.GetString("tag"), Equals, "")
+		c.Assert(log.GetString("content"), Equals, "very.large.syslog.message.tag.longer.than.32: msg")
+	}
+}
+
+func (s *AutomaticTestSuite) TestGetParser_RFC5424Parser(c *C) {
+	line := []byte("<34>1 2003-02-31T22:14:15.003Z host su - ID47 - msg")
+
+	p := rfc5424.NewParser()
+	p.SetMode(rfc5424.Strict)
+
+	// the shared parser is lenient
+	for _, codec := range []Codec{&AutomaticCodec{}, &NonTransparentCodec{}, &RFC5424Codec{}, &RFC6587Codec{}} {
+		log, err := codec.GetParser(line).Parse(line, "")
+		c.Assert(err, IsNil)
+		c.Assert(log.Warnings, HasLen, 1)
+	}
+
+	for _, codec := range []Codec{
+		&AutomaticCodec{RFC5424Parser: p},
+		&NonTransparentCodec{RFC5424Parser: p},
+		&RFC5424Codec{RFC5424Parser: p},
+		&RFC6587Codec{RFC5424Parser: p},
+	} {
+		c.Assert(codec.GetParser(line), Equals, p)
+		_, err := codec.GetParser(line).Parse(line, "")
+		c.Assert(errors.Is(err, rfc5424.ErrDayInvalid), Equals, true)
+	}
+
+	// the configured parser wins over the flags of the codec
+	lenient := rfc5424.NewParser()
+	c.Assert((&AutomaticCodec{Strict: true, RFC5424Parser: lenient}).GetParser(line), Equals, lenient)
+}
+
+func (s *AutomaticTestSuite) TestGetParser_RFC3164Layouts(c *C) {
+	line := []byte("<34>Sat Oct 11 22:14:15 2003 host su: msg")
+
+	p := rfc3164.NewParser()
+	p.SetLayouts(append(rfc3164.DefaultLayouts, rfc3164.TimeLayout(time.ANSIC))...)
+
+	log, err := (&AutomaticCodec{}).GetParser(line).Parse(line, "")
+	c.Assert(err, IsNil)
+	c.Assert(log.GetString("hostname"), Equals, "")
+
+	log, err = (&AutomaticCodec{RFC3164Parser: p}).GetParser(line).Parse(line, "")
+	c.Assert(err, IsNil)
+	c.Assert(*log.Syslog.Timestamp, Equals, time.Date(2003, 10, 11, 22, 14, 15, 0, time.UTC))
+	c.Assert(log.GetString("hostname"), Equals, "host")
+	c.Assert(log.GetString("tag"), Equals, "su")
+}
+
+func (s *AutomaticTestSuite) TestGetParser_RFC3164Clock(c *C) {
+	line := []byte("<34>Dec 31 23:59:59 host su: msg")
+
+	p := rfc3164.NewParser()
+	p.SetClock(func() time.Time { return time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC) })
+
+	for _, codec := range []Codec{&AutomaticCodec{RFC3164Parser: p}, &RFC3164Codec{RFC3164Parser: p}, &RFC6587Codec{RFC3164Parser: p}} {
+		log, err := codec.GetParser(line).Parse(line, "")
+		c.Assert(err, IsNil)
+		c.Assert(*log.Syslog.Timestamp, Equals, time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC))
+	}
+}
@@ -9,3 +9,48 @@ type Codec interface {
 	Decode(conn gnet.Conn) ([]byte, error)
 	GetParser([]byte) parser.Parser
 }
+
+// Framing of a stream, RFC6587 s3.4
+type Framing int
+
+const (
+	FramingUnknown        Framing = iota
+	FramingOctetCounting          // RFC6587 s3.4.1
+	FramingNonTransparent         // RFC6587 s3.4.2
+)
+
+// FramingContext is implemented by gnet.Conn contexts that remember the framing
+// detected on a connection. Servers keeping their own state in the connection
+// context embed ConnContext so that AutomaticCodec can share it.
+type FramingContext interface {
+	Framing() Framing
+	SetFraming(framing Framing)
+}
+
+// ConnContext is the per connection state kept by the codecs
+type ConnContext struct {
+	framing Framing
+}
+
+func (c *ConnContext) Framing() Framing {
+	return c.framing
+}
+
+func (c *ConnContext) SetFraming(framing Framing) {
+	c.framing = framing
+}
+
+// framingContext returns the FramingContext of conn, a ConnContext is attached
+// to connections that do not have a context yet
+func framingContext(conn gnet.Conn) FramingContext {
+	if fc, ok := conn.Context().(FramingContext); ok {
+		return fc
+	}
+
+	fc := &ConnContext{}
+	if conn.Context() == nil {
+		conn.SetContext(fc)
+	}
+
+	return fc
+}
@@ -0,0 +1,94 @@
+package codec
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/panjf2000/gnet/v2"
+	. "gopkg.in/check.v1"
+)
+
+// Hooks up gocheck into the gotest runner.
+func Test(t *testing.T) { TestingT(t) }
+
+// fakeConn is an in-memory gnet.Conn holding the inbound buffer of a stream,
+// only the methods used by the codecs are implemented
+type fakeConn struct {
+	gnet.Conn
+
+	buf []byte
+	ctx any
+}
+
+func (c *fakeConn) Next(n int) ([]byte, error) {
+	buf, err := c.Peek(n)
+	if err != nil {
+		return nil, err
+	}
+
+	c.buf = c.buf[len(buf):]
+	return buf, nil
+}
+
+func (c *fakeConn) Peek(n int) ([]byte, error) {
+	if n > len(c.buf) {
+		return nil, io.ErrShortBuffer
+	} else if n <= 0 {
+		n = len(c.buf)
+	}
+
+	return c.buf[:n], nil
+}
+
+func (c *fakeConn) Discard(n int) (int, error) {
+	if n >= len(c.buf) || n <= 0 {
+		n = len(c.buf)
+	}
+
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *fakeConn) InboundBuffered() int {
+	return len(c.buf)
+}
+
+func (c *fakeConn) Context() any {
+	return c.ctx
+}
+
+func (c *fakeConn) SetContext(ctx any) {
+	c.ctx = ctx
+}
+
+func (c *fakeConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40000}
+}
+
+// feed writes the chunks one after the other into a fakeConn, decoding every
+// complete frame after each chunk the way Server.OnTraffic does. It stops at
+// the first error that is not ErrIncompletePacket.
+func feed(codec Codec, chunks []string) ([]string, error) {
+	conn := &fakeConn{}
+	frames := make([]string, 0)
+
+	for _, chunk := range chunks {
+		conn.buf = append(conn.buf, chunk...)
+
+		for conn.InboundBuffered() > 0 {
+			data, err := codec.Decode(conn)
+			if err == ErrIncompletePacket {
+				break
+			}
+
+			if err != nil {
+				return frames, err
+			}
+
+			frames = append(frames, string(data))
+		}
+	}
+
+	return frames, nil
+}
@@ -0,0 +1,95 @@
+package codec
+
+import (
+	"bytes"
+	"github.com/crazy-airhead/gsyslog/parser"
+	"github.com/crazy-airhead/gsyslog/parser/rfc3164"
+	"github.com/crazy-airhead/gsyslog/parser/rfc5424"
+	"github.com/panjf2000/gnet/v2"
+)
+
+// Trailer terminates every frame of a non-transparent framed stream, RFC6587 s3.4.2
+type Trailer []byte
+
+var (
+	TrailerLF   = Trailer("\n")
+	TrailerCRLF = Trailer("\r\n")
+	TrailerNUL  = Trailer("\x00")
+)
+
+// CustomTrailer returns a Trailer made of a single custom byte
+func CustomTrailer(b byte) Trailer {
+	return Trailer{b}
+}
+
+// NonTransparentCodec decodes non-transparent framed messages, RFC6587 s3.4.2:
+//
+//	SYSLOG-FRAME = SYSLOG-MSG TRAILER
+//
+// The parser is selected per message, as with AutomaticCodec.
+type NonTransparentCodec struct {
+	// Trailer ends every frame, TrailerLF when nil
+	Trailer Trailer
+	// MaxFrameSize is the largest frame accepted, DefaultMaxFrameSize when zero
+	MaxFrameSize int
+	// Strict parses RFC5424 messages in rfc5424.Strict mode
+	Strict bool
+	// ReplaceInvalidUTF8 replaces the invalid UTF-8 sequences of RFC5424 MSG,
+	// see rfc5424.Parser.SetReplaceInvalidUTF8
+	ReplaceInvalidUTF8 bool
+	// RFC3164Parser parses the RFC3164 messages, e.g. with a tag length limit
+	// (rfc3164.Parser.SetMaxTagLen), a shared default parser when nil
+	RFC3164Parser *rfc3164.Parser
+	// RFC5424Parser parses the RFC5424 messages, e.g. with a custom mode, a
+	// shared parser set up from Strict and ReplaceInvalidUTF8 when nil
+	RFC5424Parser *rfc5424.Parser
+}
+
+func (f *NonTransparentCodec) GetParser(data []byte) parser.Parser {
+	return getParser(data, f.RFC3164Parser, f.RFC5424Parser, rfc5424Options{f.Strict, f.ReplaceInvalidUTF8})
+}
+
+func (f *NonTransparentCodec) Decode(conn gnet.Conn) ([]byte, error) {
+	return decodeNonTransparent(conn, f.Trailer, f.MaxFrameSize)
+}
+
+// decodeNonTransparent returns the next non empty frame without its trailer,
+// empty frames (i.e. consecutive trailers) are skipped
+func decodeNonTransparent(conn gnet.Conn, trailer Trailer, maxFrameSize int) ([]byte, error) {
+	if len(trailer) == 0 {
+		trailer = TrailerLF
+	}
+
+	if maxFrameSize <= 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+
+	for {
+		buf, _ := conn.Peek(-1)
+
+		i := bytes.Index(buf, trailer)
+		if i < 0 {
+			if len(buf) > maxFrameSize {
+				return nil, ErrFrameTooLarge
+			}
+
+			return nil, ErrIncompletePacket
+		}
+
+		if i > maxFrameSize {
+			return nil, ErrFrameTooLarge
+		}
+
+		if i == 0 {
+			_, _ = conn.Discard(len(trailer))
+			continue
+		}
+
+		body := make([]byte, i)
+		copy(body, buf[:i])
+
+		_, _ = conn.Discard(i + len(trailer))
+
+		return body, nil
+	}
+}
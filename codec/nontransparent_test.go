@@ -0,0 +1,95 @@
+package codec
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type NonTransparentTestSuite struct {
+}
+
+var _ = Suite(&NonTransparentTestSuite{})
+
+func (s *NonTransparentTestSuite) TestDecode(c *C) {
+	fixtures := []struct {
+		name   string
+		codec  Codec
+		chunks []string
+		frames []string
+		err    error
+	}{
+		{
+			name:   "default trailer is LF",
+			codec:  &NonTransparentCodec{},
+			chunks: []string{"<34>a\n<34>b\n"},
+			frames: []string{"<34>a", "<34>b"},
+		},
+		{
+			name:   "partial line kept across reads",
+			codec:  &NonTransparentCodec{},
+			chunks: []string{"<34>Oct 11 22:1", "4:15 host a: msg\n<34>", "Oct 11 22:14:16 host b: msg\n"},
+			frames: []string{"<34>Oct 11 22:14:15 host a: msg", "<34>Oct 11 22:14:16 host b: msg"},
+		},
+		{
+			name:   "empty frames are skipped",
+			codec:  &NonTransparentCodec{},
+			chunks: []string{"\n\na\n\n", "\nb\n"},
+			frames: []string{"a", "b"},
+		},
+		{
+			name:   "missing trailer",
+			codec:  &NonTransparentCodec{},
+			chunks: []string{"a\nb"},
+			frames: []string{"a"},
+		},
+		{
+			name:   "NUL trailer",
+			codec:  &NonTransparentCodec{Trailer: TrailerNUL},
+			chunks: []string{"a\nb\x00c", "\x00"},
+			frames: []string{"a\nb", "c"},
+		},
+		{
+			name:   "CRLF trailer split between reads",
+			codec:  &NonTransparentCodec{Trailer: TrailerCRLF},
+			chunks: []string{"a\nb\r", "\nc\r\n"},
+			frames: []string{"a\nb", "c"},
+		},
+		{
+			name:   "custom trailer",
+			codec:  &NonTransparentCodec{Trailer: CustomTrailer('|')},
+			chunks: []string{"a|b|"},
+			frames: []string{"a", "b"},
+		},
+		{
+			name:   "frame too large without trailer",
+			codec:  &NonTransparentCodec{MaxFrameSize: 4},
+			chunks: []string{"abc\nabcdef"},
+			frames: []string{"abc"},
+			err:    ErrFrameTooLarge,
+		},
+		{
+			name:   "frame too large with trailer",
+			codec:  &NonTransparentCodec{MaxFrameSize: 4},
+			chunks: []string{"abcde\n"},
+			frames: []string{},
+			err:    ErrFrameTooLarge,
+		},
+		{
+			name:   "RFC3164Codec",
+			codec:  &RFC3164Codec{},
+			chunks: []string{"<34>a\n<3", "4>b\n"},
+			frames: []string{"<34>a", "<34>b"},
+		},
+		{
+			name:   "RFC5424Codec",
+			codec:  &RFC5424Codec{Trailer: TrailerNUL},
+			chunks: []string{"<34>1 a\x00<34>1 b\x00"},
+			frames: []string{"<34>1 a", "<34>1 b"},
+		},
+	}
+
+	for _, f := range fixtures {
+		frames, err := feed(f.codec, f.chunks)
+		c.Check(err, Equals, f.err, Commentf(f.name))
+		c.Check(frames, DeepEquals, f.frames, Commentf(f.name))
+	}
+}
@@ -2,23 +2,26 @@ package codec
 
 import (
 	"github.com/crazy-airhead/gsyslog/parser"
+	"github.com/crazy-airhead/gsyslog/parser/rfc3164"
 	"github.com/panjf2000/gnet/v2"
 )
 
-type RFC3164Codec struct{}
+// RFC3164Codec parses every message as RFC3164. On streams the messages are
+// framed with non-transparent framing, see NonTransparentCodec.
+type RFC3164Codec struct {
+	// Trailer ends every frame on streams, TrailerLF when nil
+	Trailer Trailer
+	// MaxFrameSize is the largest frame accepted, DefaultMaxFrameSize when zero
+	MaxFrameSize int
+	// RFC3164Parser parses the RFC3164 messages, e.g. with a tag length limit
+	// (rfc3164.Parser.SetMaxTagLen), a shared default parser when nil
+	RFC3164Parser *rfc3164.Parser
+}
 
 func (f *RFC3164Codec) GetParser(data []byte) parser.Parser {
-	return rfc3164Parser
+	return getRfc3164Parser(f.RFC3164Parser)
 }
 
 func (f *RFC3164Codec) Decode(conn gnet.Conn) ([]byte, error) {
-	buf, _ := conn.Next(-1)
-
-	length := len(buf)
-	body := make([]byte, length)
-	copy(body, buf)
-
-	_, _ = conn.Discard(length)
-
-	return body, nil
+	return decodeNonTransparent(conn, f.Trailer, f.MaxFrameSize)
 }
@@ -2,23 +2,31 @@ package codec
 
 import (
 	"github.com/crazy-airhead/gsyslog/parser"
+	"github.com/crazy-airhead/gsyslog/parser/rfc5424"
 	"github.com/panjf2000/gnet/v2"
 )
 
-type RFC5424Codec struct{}
+// RFC5424Codec parses every message as RFC5424. On streams the messages are
+// framed with non-transparent framing, see NonTransparentCodec.
+type RFC5424Codec struct {
+	// Trailer ends every frame on streams, TrailerLF when nil
+	Trailer Trailer
+	// MaxFrameSize is the largest frame accepted, DefaultMaxFrameSize when zero
+	MaxFrameSize int
+	// Strict parses RFC5424 messages in rfc5424.Strict mode
+	Strict bool
+	// ReplaceInvalidUTF8 replaces the invalid UTF-8 sequences of RFC5424 MSG,
+	// see rfc5424.Parser.SetReplaceInvalidUTF8
+	ReplaceInvalidUTF8 bool
+	// RFC5424Parser parses the RFC5424 messages, e.g. with a custom mode, a
+	// shared parser set up from Strict and ReplaceInvalidUTF8 when nil
+	RFC5424Parser *rfc5424.Parser
+}
 
 func (f *RFC5424Codec) GetParser(data []byte) parser.Parser {
-	return rfc5424Parser
+	return getRfc5424Parser(f.RFC5424Parser, rfc5424Options{f.Strict, f.ReplaceInvalidUTF8})
 }
 
 func (f *RFC5424Codec) Decode(conn gnet.Conn) ([]byte, error) {
-	buf, _ := conn.Next(-1)
-
-	length := len(buf)
-	body := make([]byte, length)
-	copy(body, buf)
-
-	_, _ = conn.Discard(length)
-
-	return body, nil
+	return decodeNonTransparent(conn, f.Trailer, f.MaxFrameSize)
 }
@@ -1,34 +1,98 @@
 package codec
 
 import (
-	"encoding/binary"
 	"github.com/crazy-airhead/gsyslog/parser"
+	"github.com/crazy-airhead/gsyslog/parser/rfc3164"
 	"github.com/crazy-airhead/gsyslog/parser/rfc5424"
 	"github.com/panjf2000/gnet/v2"
 )
 
-type RFC6587Codec struct{}
+const (
+	// DefaultMaxFrameSize is the largest MSG-LEN accepted when RFC6587Codec.MaxFrameSize is not set
+	DefaultMaxFrameSize = 64 * 1024
+
+	// maxLengthDigits bounds the MSG-LEN prefix, enough for any int32 length
+	maxLengthDigits = 10
+)
+
+// RFC6587Codec decodes octet-counting framed messages, RFC6587 s3.4.1:
+//
+//	SYSLOG-FRAME = MSG-LEN SP SYSLOG-MSG
+//	MSG-LEN      = NONZERO-DIGIT *DIGIT
+//
+// The parser is selected per message, as with AutomaticCodec: rsyslog and
+// syslog-ng also frame RFC3164 messages with octet counting.
+type RFC6587Codec struct {
+	// MaxFrameSize is the largest MSG-LEN accepted, DefaultMaxFrameSize when zero
+	MaxFrameSize int
+	// Strict parses RFC5424 messages in rfc5424.Strict mode
+	Strict bool
+	// ReplaceInvalidUTF8 replaces the invalid UTF-8 sequences of RFC5424 MSG,
+	// see rfc5424.Parser.SetReplaceInvalidUTF8
+	ReplaceInvalidUTF8 bool
+	// RFC3164Parser parses the RFC3164 messages, e.g. with a tag length limit
+	// (rfc3164.Parser.SetMaxTagLen), a shared default parser when nil
+	RFC3164Parser *rfc3164.Parser
+	// RFC5424Parser parses the RFC5424 messages, e.g. with a custom mode, a
+	// shared parser set up from Strict and ReplaceInvalidUTF8 when nil
+	RFC5424Parser *rfc5424.Parser
+}
 
 func (f *RFC6587Codec) GetParser(data []byte) parser.Parser {
-	return rfc5424.NewParser()
+	return getParser(data, f.RFC3164Parser, f.RFC5424Parser, rfc5424Options{f.Strict, f.ReplaceInvalidUTF8})
 }
 
 func (f *RFC6587Codec) Decode(conn gnet.Conn) ([]byte, error) {
-	if conn.InboundBuffered() < 4 {
-		// 如果没有找到换行符，说明数据不完整，等待更多数据
-		return nil, ErrIncompletePacket
+	return decodeOctetCounting(conn, f.MaxFrameSize)
+}
+
+func decodeOctetCounting(conn gnet.Conn, maxFrameSize int) ([]byte, error) {
+	if maxFrameSize <= 0 {
+		maxFrameSize = DefaultMaxFrameSize
 	}
 
-	lenBuf, _ := conn.Peek(4)
-	length := binary.BigEndian.Uint32(lenBuf)
+	buf, _ := conn.Peek(-1)
 
-	_, _ = conn.Discard(4)
+	length, prefixLen, err := parseFrameLength(buf, maxFrameSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) < prefixLen+length {
+		return nil, ErrIncompletePacket
+	}
 
-	buf, _ := conn.Next(int(length))
 	body := make([]byte, length)
-	copy(body, buf)
+	copy(body, buf[prefixLen:prefixLen+length])
+
+	_, _ = conn.Discard(prefixLen + length)
+
+	return body, nil
+}
+
+// parseFrameLength reads the MSG-LEN prefix, returning the length and the size
+// of the prefix including the trailing space
+func parseFrameLength(buf []byte, maxFrameSize int) (int, int, error) {
+	length := 0
 
-	_, _ = conn.Discard(int(length))
+	for i, c := range buf {
+		if c == ' ' {
+			if i == 0 {
+				return 0, 0, ErrInvalidFrameLength
+			}
+
+			return length, i + 1, nil
+		}
+
+		if !parser.IsDigit(c) || (i == 0 && c == '0') || i >= maxLengthDigits {
+			return 0, 0, ErrInvalidFrameLength
+		}
+
+		length = length*10 + int(c-'0')
+		if length > maxFrameSize {
+			return 0, 0, ErrFrameTooLarge
+		}
+	}
 
-	return nil, nil
+	return 0, 0, ErrIncompletePacket
 }
@@ -0,0 +1,126 @@
+package codec
+
+import (
+	"github.com/crazy-airhead/gsyslog/parser/rfc3164"
+	"github.com/crazy-airhead/gsyslog/parser/rfc5424"
+	. "gopkg.in/check.v1"
+)
+
+type Rfc6587TestSuite struct {
+}
+
+var _ = Suite(&Rfc6587TestSuite{})
+
+func (s *Rfc6587TestSuite) TestDecode(c *C) {
+	fixtures := []struct {
+		name   string
+		codec  *RFC6587Codec
+		chunks []string
+		frames []string
+		err    error
+	}{
+		{
+			name:   "single frame",
+			codec:  &RFC6587Codec{},
+			chunks: []string{"11 <34>1 - - -"},
+			frames: []string{"<34>1 - - -"},
+		},
+		{
+			name:   "multiple frames in one read",
+			codec:  &RFC6587Codec{},
+			chunks: []string{"5 <34>a6 <34>bc3 xyz"},
+			frames: []string{"<34>a", "<34>bc", "xyz"},
+		},
+		{
+			name:   "frame split across reads",
+			codec:  &RFC6587Codec{},
+			chunks: []string{"1", "1 <34>1", " - -", " -4 ab", "cd"},
+			frames: []string{"<34>1 - - -", "abcd"},
+		},
+		{
+			name:   "one byte at a time",
+			codec:  &RFC6587Codec{},
+			chunks: []string{"1", "1", " ", "h", "e", "l", "l", "o", " ", "w", "o", "r", "l", "d"},
+			frames: []string{"hello world"},
+		},
+		{
+			name:   "frame containing newlines and spaces",
+			codec:  &RFC6587Codec{},
+			chunks: []string{"8 a b\nc d\n"},
+			frames: []string{"a b\nc d\n"},
+		},
+		{
+			name:   "incomplete frame",
+			codec:  &RFC6587Codec{},
+			chunks: []string{"3 ab"},
+			frames: []string{},
+		},
+		{
+			name:   "oversize length prefix",
+			codec:  &RFC6587Codec{MaxFrameSize: 10},
+			chunks: []string{"3 abc11 hello world"},
+			frames: []string{"abc"},
+			err:    ErrFrameTooLarge,
+		},
+		{
+			name:   "oversize length detected before the space",
+			codec:  &RFC6587Codec{},
+			chunks: []string{"99999999"},
+			frames: []string{},
+			err:    ErrFrameTooLarge,
+		},
+		{
+			name:   "non digit prefix",
+			codec:  &RFC6587Codec{},
+			chunks: []string{"<34>Oct 11 22:14:15 host tag: msg"},
+			frames: []string{},
+			err:    ErrInvalidFrameLength,
+		},
+		{
+			name:   "leading zero",
+			codec:  &RFC6587Codec{},
+			chunks: []string{"05 hello"},
+			frames: []string{},
+			err:    ErrInvalidFrameLength,
+		},
+		{
+			name:   "empty length",
+			codec:  &RFC6587Codec{},
+			chunks: []string{" hello"},
+			frames: []string{},
+			err:    ErrInvalidFrameLength,
+		},
+		{
+			name:   "too many digits",
+			codec:  &RFC6587Codec{MaxFrameSize: 1 << 62},
+			chunks: []string{"12345678901 a"},
+			frames: []string{},
+			err:    ErrInvalidFrameLength,
+		},
+	}
+
+	for _, f := range fixtures {
+		frames, err := feed(f.codec, f.chunks)
+		c.Check(err, Equals, f.err, Commentf(f.name))
+		c.Check(frames, DeepEquals, f.frames, Commentf(f.name))
+	}
+}
+
+func (s *Rfc6587TestSuite) TestGetParser(c *C) {
+	codec := &RFC6587Codec{}
+
+	frames, err := feed(codec, []string{"32 <34>Oct 11 22:14:15 host su: msg", "51 <34>1 2003-10-11T22:14:15.003Z host su - ID47 - msg"})
+	c.Assert(err, IsNil)
+	c.Assert(frames, HasLen, 2)
+
+	// the RFC3164 messages framed with octet counting are not parsed as RFC5424
+	p := codec.GetParser([]byte(frames[0]))
+	c.Assert(p, FitsTypeOf, &rfc3164.Parser{})
+	log, err := p.Parse([]byte(frames[0]), "")
+	c.Assert(err, IsNil)
+	c.Assert(log.GetString("hostname"), Equals, "host")
+	c.Assert(log.GetString("tag"), Equals, "su")
+	c.Assert(log.GetString("content"), Equals, "msg")
+
+	c.Assert(codec.GetParser([]byte(frames[1])), FitsTypeOf, &rfc5424.Parser{})
+}
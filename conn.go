@@ -0,0 +1,110 @@
+package gsyslog
+
+import (
+	"github.com/crazy-airhead/gsyslog/codec"
+	"github.com/crazy-airhead/gsyslog/parser"
+	"github.com/panjf2000/gnet/v2"
+	"io"
+	"net"
+)
+
+// connContext is the state kept in the context of every stream connection,
+// it embeds the codec.ConnContext used by the codecs
+type connContext struct {
+	codec.ConnContext
+
+	// id of the stream connection, unique within the server, 0 for datagrams
+	id uint64
+	// local address of the stream connection
+	local string
+	// cred of the peer process on unix sockets
+	cred *parser.Credential
+	// subject of the client certificate on tls connections
+	subject string
+}
+
+// decorate adds the peer information of the connection to log
+func (c *connContext) decorate(log *parser.Log) {
+	if c.cred != nil {
+		log.SetPeerCred(*c.cred)
+	}
+
+	if c.subject != "" {
+		log.SetPeerSubject(c.subject)
+	}
+}
+
+// streamConn adapts a net.Conn that is served outside gnet (e.g. TLS) to the
+// subset of gnet.Conn used by the codecs: the Reader methods, the context and
+// the addresses. Any other gnet.Conn method panics, as the embedded Conn is nil.
+type streamConn struct {
+	gnet.Conn
+
+	conn net.Conn
+	buf  []byte
+	ctx  any
+}
+
+func newStreamConn(conn net.Conn) *streamConn {
+	return &streamConn{
+		conn: conn,
+	}
+}
+
+// fill appends data read from the underlying connection to the inbound buffer
+func (c *streamConn) fill(data []byte) {
+	c.buf = append(c.buf, data...)
+}
+
+func (c *streamConn) Next(n int) ([]byte, error) {
+	buf, err := c.Peek(n)
+	if err != nil {
+		return nil, err
+	}
+
+	c.buf = c.buf[len(buf):]
+
+	return buf, nil
+}
+
+func (c *streamConn) Peek(n int) ([]byte, error) {
+	if n > len(c.buf) {
+		return nil, io.ErrShortBuffer
+	} else if n <= 0 {
+		n = len(c.buf)
+	}
+
+	return c.buf[:n], nil
+}
+
+func (c *streamConn) Discard(n int) (int, error) {
+	if n >= len(c.buf) || n <= 0 {
+		n = len(c.buf)
+		c.buf = c.buf[:0]
+		return n, nil
+	}
+
+	c.buf = c.buf[n:]
+
+	return n, nil
+}
+
+func (c *streamConn) InboundBuffered() int {
+	return len(c.buf)
+}
+
+func (c *streamConn) Context() any {
+	return c.ctx
+}
+
+func (c *streamConn) SetContext(ctx any) {
+	c.ctx = ctx
+}
+
+func (c *streamConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *streamConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
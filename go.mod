@@ -3,19 +3,20 @@ module github.com/crazy-airhead/gsyslog
 go 1.23.1
 
 require (
+	github.com/panjf2000/ants/v2 v2.10.0
 	github.com/panjf2000/gnet/v2 v2.7.1
+	golang.org/x/sys v0.25.0
+	golang.org/x/text v0.18.0
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127
 )
 
 require (
 	github.com/kr/pretty v0.1.0 // indirect
 	github.com/kr/text v0.1.0 // indirect
-	github.com/panjf2000/ants/v2 v2.10.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
 	go.uber.org/zap v1.21.0 // indirect
 	golang.org/x/sync v0.8.0 // indirect
-	golang.org/x/sys v0.25.0 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1 // indirect
 )
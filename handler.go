@@ -6,11 +6,34 @@ import (
 	"sync/atomic"
 )
 
-// Handler The handler receive every syslog entry at Handle method
+// Handler The handler receive every syslog entry at Handle method.
+//
+// The log belongs to the handler, unless logs are pooled by Server.SetLogPooling:
+// the log, its Body and the slices returned by GetBytes are then reused once
+// Handle returns, so they must not be kept. Strings may be kept, and Clone
+// returns a copy of the log that may be kept. A pooled log is materialized
+// before Handle, its Header and Syslog being filled, unless the handler is a
+// LazyHandler.
 type Handler interface {
 	Handle(log *parser.Log)
 }
 
+// LazyHandler is a Handler reading the pooled logs as they are parsed, without
+// converting their fields to strings first: the string fields of Syslog and
+// most of the Header stay empty until GetString, Get or Materialize is called,
+// while GetBytes and StructuredData read the raw bytes, see parser.AcquireLog.
+type LazyHandler interface {
+	Handler
+	// Lazy tells whether Handle reads the pooled logs lazily
+	Lazy() bool
+}
+
+// isLazy tells whether h reads the pooled logs lazily
+func isLazy(h Handler) bool {
+	lazy, ok := h.(LazyHandler)
+	return ok && lazy.Lazy()
+}
+
 type DefaultHandler struct {
 	counter *int64
 }
@@ -21,9 +44,15 @@ func NewDefaultHandler() *DefaultHandler {
 	}
 }
 
+// Lazy the log is materialized by Handle
+func (h *DefaultHandler) Lazy() bool {
+	return true
+}
+
 // Handle entry receiver
 func (h *DefaultHandler) Handle(log *parser.Log) {
 	atomic.AddInt64(h.counter, 1)
+	log.Materialize()
 
 	logging.Infof("number %d, header:%v, body:%v,", *h.counter, log.Header, log.GetString(parser.LogBody))
 }
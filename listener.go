@@ -0,0 +1,411 @@
+package gsyslog
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/crazy-airhead/gsyslog/charset"
+	"github.com/crazy-airhead/gsyslog/codec"
+	"github.com/crazy-airhead/gsyslog/parser"
+	"github.com/panjf2000/gnet/v2"
+	"github.com/panjf2000/gnet/v2/pkg/logging"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Listener is one address served by a Server. Every listener has its own codec
+// and handler, falling back to the ones of the Server when not set, while all
+// the listeners of a Server share its worker pool.
+type Listener struct {
+	gnet.BuiltinEventEngine
+	eng     gnet.Engine
+	server  *Server
+	name    string
+	addr    string
+	network string
+
+	codec   codec.Codec
+	handler Handler
+	charset *charset.Charset
+
+	tlsConfig           *tls.Config
+	tlsHandshakeTimeout time.Duration
+	tlsListener         net.Listener
+	tlsConns            map[net.Conn]struct{}
+	mu                  sync.Mutex
+
+	unixMode     os.FileMode
+	unixUid      int
+	unixGid      int
+	unixChown    bool
+	unixgramConn *net.UnixConn
+
+	// local the address of the datagram listeners, set once bound
+	local     string
+	localOnce sync.Once
+
+	// stopped is set by stop, a listener stopped before it is bound shuts down right away
+	stopped bool
+	// booted is closed once the gnet engine accepts traffic
+	booted chan struct{}
+	// done is closed once the listener is not served anymore, err tells why
+	done chan struct{}
+	err  error
+	// wg tracks the goroutines serving the connections outside gnet
+	wg sync.WaitGroup
+}
+
+// NewListener returns a new Listener on addr, see SetAddr
+func NewListener(addr string) *Listener {
+	l := &Listener{}
+	l.SetAddr(addr)
+
+	return l
+}
+
+// SetName Sets the name of the listener, the address is used when not set
+func (l *Listener) SetName(name string) {
+	l.name = name
+}
+
+// SetHandler Sets the handler of the listener
+func (l *Listener) SetHandler(handler Handler) {
+	l.handler = handler
+}
+
+// SetCodec Sets the syslog codec of the listener
+func (l *Listener) SetCodec(f codec.Codec) {
+	l.codec = f
+}
+
+// SetAddr Sets the listen address, one of udp://host:port, tcp://host:port,
+// tls://host:port, unix:///path (stream) or unixgram:///path (datagram, e.g. /dev/log)
+func (l *Listener) SetAddr(addr string) {
+	if strings.HasPrefix(addr, "udp://") {
+		l.network = "udp"
+		l.addr = addr
+	} else if strings.HasPrefix(addr, "tcp://") {
+		l.network = "tcp"
+		l.addr = addr
+	} else if strings.HasPrefix(addr, "unix://") {
+		l.network = "unix"
+		l.addr = addr
+	} else if strings.HasPrefix(addr, "unixgram://") {
+		l.network = "unixgram"
+		l.addr = addr
+	} else if strings.HasPrefix(addr, "tls://") {
+		l.network = "tls"
+		l.addr = addr
+	}
+}
+
+// Name returns the name of the listener
+func (l *Listener) Name() string {
+	if l.name != "" {
+		return l.name
+	}
+
+	return l.addr
+}
+
+// Addr returns the listen address
+func (l *Listener) Addr() string {
+	return l.addr
+}
+
+func (l *Listener) getCodec() codec.Codec {
+	if l.codec != nil {
+		return l.codec
+	}
+
+	return l.server.codec
+}
+
+func (l *Listener) getHandler() Handler {
+	if l.handler != nil {
+		return l.handler
+	}
+
+	return l.server.handler
+}
+
+// bind binds the listener then serves it in the background until it is
+// stopped, bind errors are returned synchronously
+func (l *Listener) bind(ctx context.Context) error {
+	l.mu.Lock()
+	l.done = make(chan struct{})
+	l.mu.Unlock()
+
+	if l.network == "tls" {
+		return l.bindTLS()
+	}
+
+	if l.network == "unixgram" {
+		return l.bindUnixgram()
+	}
+
+	if l.network == "unix" {
+		if path := l.unixPath(); path != strings.ToLower(path) {
+			return ErrUnixPathCase
+		}
+
+		if err := removeStaleSocket(l.unixPath()); err != nil {
+			return err
+		}
+	}
+
+	l.booted = make(chan struct{})
+	l.run(func() error {
+		// SO_REUSEADDR, the port of a server shut down with open connections
+		// is in TIME_WAIT until then
+		return gnet.Run(l, l.addr,
+			gnet.WithMulticore(true),
+			gnet.WithReuseAddr(true),
+			gnet.WithSocketRecvBuffer(l.server.bufferSize))
+	})
+
+	select {
+	case <-l.booted:
+		return nil
+	case <-l.done:
+		if err := l.wait(); err != nil {
+			return err
+		}
+
+		return ErrListenerStopped
+	case <-ctx.Done():
+		_ = l.stop(context.Background())
+		return ctx.Err()
+	}
+}
+
+// run serves the listener in the background, the error that ended serving is
+// returned by wait
+func (l *Listener) run(serve func() error) {
+	go func() {
+		err := serve()
+
+		l.mu.Lock()
+		if err != nil {
+			l.err = err
+		}
+		done := l.done
+		l.mu.Unlock()
+
+		close(done)
+	}()
+}
+
+// wait blocks until the listener is not served anymore
+func (l *Listener) wait() error {
+	l.mu.Lock()
+	done := l.done
+	l.mu.Unlock()
+
+	if done == nil {
+		return nil
+	}
+
+	<-done
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.err
+}
+
+// stop stops accepting traffic and waits until the listener is not served
+// anymore, that is no more message is dispatched to the worker pool
+func (l *Listener) stop(ctx context.Context) error {
+	l.mu.Lock()
+	l.stopped = true
+	eng := l.eng
+	done := l.done
+	l.mu.Unlock()
+
+	if l.network == "tls" {
+		l.stopTLS()
+	} else if l.network == "unixgram" {
+		l.stopUnixgram()
+	} else if err := eng.Validate(); err == nil {
+		_ = eng.Stop(ctx)
+	}
+
+	if done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if l.network == "unix" {
+		_ = removeStaleSocket(l.unixPath())
+	}
+
+	return nil
+}
+
+func (l *Listener) OnBoot(eng gnet.Engine) gnet.Action {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stopped {
+		return gnet.Shutdown
+	}
+
+	if l.network == "unix" {
+		if err := l.setupUnixSocket(l.unixPath()); err != nil {
+			l.err = err
+			return gnet.Shutdown
+		}
+	}
+
+	l.eng = eng
+	close(l.booted)
+
+	logging.Infof("syslog server is listening on %s\n", l.addr)
+
+	return gnet.None
+}
+
+func (l *Listener) OnOpen(conn gnet.Conn) (out []byte, action gnet.Action) {
+	ctx := &connContext{id: l.server.connIDs.Add(1), local: conn.LocalAddr().String()}
+	if l.network == "unix" {
+		ctx.cred = peerCred(conn.Fd())
+	}
+
+	conn.SetContext(ctx)
+
+	return nil, gnet.None
+}
+
+func (l *Listener) OnTraffic(conn gnet.Conn) (action gnet.Action) {
+	if l.network == "udp" {
+		return l.handleUdp(conn)
+	}
+
+	if l.network == "tcp" || l.network == "unix" {
+		return l.handleTcp(conn)
+	}
+
+	return gnet.None
+}
+
+func (l *Listener) handleUdp(conn gnet.Conn) (action gnet.Action) {
+	data, err := conn.Next(-1)
+	if err != nil {
+		logging.Errorf("syslog read buff, something wrong, error:%v", err)
+		return gnet.None
+	}
+
+	received := time.Now()
+	l.localOnce.Do(func() {
+		l.local = conn.LocalAddr().String()
+	})
+
+	client := conn.RemoteAddr().String()
+	copyData, buf := l.server.copyDatagram(data)
+	l.server.dispatch(&task{
+		listener: l,
+		data:     copyData,
+		client:   client,
+		buf:      buf,
+		received: received,
+		local:    l.local,
+	})
+
+	return gnet.None
+}
+
+func (l *Listener) handleTcp(conn gnet.Conn) (action gnet.Action) {
+	client := conn.RemoteAddr().String()
+	ctx, _ := conn.Context().(*connContext)
+
+	err := l.decode(conn, func(data []byte) {
+		l.dispatch(data, client, ctx)
+	})
+	if err != nil {
+		logging.Errorf("syslog decode from %s failed, closing the connection, error:%v", client, err)
+		return gnet.Close
+	}
+
+	return gnet.None
+}
+
+// decode submits every complete frame buffered on conn, partial frames stay
+// buffered until more data arrives. An error means the stream can not be framed
+// anymore and the connection should be closed.
+func (l *Listener) decode(conn gnet.Conn, submit func(data []byte)) error {
+	c := l.getCodec()
+	for conn.InboundBuffered() > 0 {
+		data, err := c.Decode(conn)
+		if errors.Is(err, codec.ErrIncompletePacket) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(data) == 0 {
+			return nil
+		}
+
+		submit(data)
+	}
+
+	return nil
+}
+
+// dispatch hands the message over to the server, which parses it on the
+// worker pool. ctx holds the peer information of the connection, if any.
+func (l *Listener) dispatch(data []byte, client string, ctx *connContext) {
+	t := &task{
+		listener: l,
+		data:     data,
+		client:   client,
+		ctx:      ctx,
+		received: time.Now(),
+	}
+	if ctx != nil {
+		t.local = ctx.local
+	}
+
+	l.server.dispatch(t)
+}
+
+// parse parses line, into a pooled Log when logs are pooled and the parser
+// supports it, see Server.SetLogPooling. The timestamps without a zone are in
+// the timezone of the source, see Server.SetSourceTimezone. The envelope is
+// set before parsing, its receive time being the reference time of the
+// timestamps without a year.
+func (l *Listener) parse(line []byte, client string, envelope parser.Envelope) (*parser.Log, bool) {
+	p := l.getCodec().GetParser(line)
+
+	lp, ok := p.(parser.LogParser)
+	if !ok {
+		log, _ := p.Parse(line, client)
+		log.SetEnvelope(envelope)
+		return log, false
+	}
+
+	var log *parser.Log
+	if l.server.pooling {
+		log = parser.AcquireLog(line)
+	} else {
+		log = parser.NewLog(line)
+	}
+
+	log.SetEnvelope(envelope)
+	if l.server.timezones.enabled.Load() {
+		log.SetTimezoneResolver(&l.server.timezones)
+	}
+
+	_ = lp.ParseLog(log, client)
+
+	return log, l.server.pooling
+}
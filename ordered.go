@@ -0,0 +1,181 @@
+package gsyslog
+
+import (
+	"github.com/panjf2000/gnet/v2/pkg/logging"
+	"hash/fnv"
+	"net"
+	"runtime"
+	"sync"
+)
+
+// Ordering tells which messages are handled in the order they were received
+type Ordering int
+
+const (
+	// OrderNone handles every message independently on the worker pool
+	OrderNone Ordering = iota
+	// OrderPerConnection handles the messages of a stream connection in order.
+	// Datagram transports have no connection, their messages are ordered per
+	// source address instead.
+	OrderPerConnection
+	// OrderPerSource handles the messages of a source address in order, whatever
+	// the connection or the port they come from
+	OrderPerSource
+)
+
+// DefaultShardQueueSize is the size of every shard queue when not set
+const DefaultShardQueueSize = 1024
+
+// ordered runs the messages on shards, a shard being a goroutine handling its
+// queue in order. All the messages of a key go to the same shard, so they are
+// ordered while different keys run in parallel on the other shards.
+type ordered struct {
+	server *Server
+
+	ordering Ordering
+	shards   int
+
+	startOnce sync.Once
+	// mu guards closed, it is held for reading while a task is queued
+	mu     sync.RWMutex
+	closed bool
+	queues []chan *task
+	wg     sync.WaitGroup
+}
+
+// SetOrdering Sets which messages are handled in order, OrderNone by default.
+// Ordered messages run on dedicated shards instead of the worker pool.
+func (s *Server) SetOrdering(ordering Ordering) {
+	s.ordered.ordering = ordering
+}
+
+// SetOrderedShards Sets how many shards handle the ordered messages in
+// parallel, runtime.NumCPU() by default
+func (s *Server) SetOrderedShards(n int) {
+	s.ordered.shards = n
+}
+
+func (o *ordered) enabled() bool {
+	return o.ordering != OrderNone
+}
+
+func (o *ordered) start() {
+	n := o.shards
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+
+	size := o.server.overflow.queueSize
+	if size <= 0 {
+		size = DefaultShardQueueSize
+	}
+
+	o.queues = make([]chan *task, n)
+	for i := range o.queues {
+		o.queues[i] = make(chan *task, size)
+
+		o.wg.Add(1)
+		go o.serve(o.queues[i])
+	}
+}
+
+// serve handles the tasks of a shard in order until the shard is closed
+func (o *ordered) serve(queue chan *task) {
+	defer o.wg.Done()
+
+	for t := range queue {
+		o.run(t)
+	}
+}
+
+// run handles t on the shard. A handler panic is accounted for by
+// overflow.run, it is recovered so that the shard keeps serving, as the worker
+// pool does.
+func (o *ordered) run(t *task) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.Errorf("syslog ordered shard panic: %v", r)
+		}
+	}()
+
+	o.server.overflow.run(t)
+}
+
+// submit queues t on the shard of its key. A full shard is handled according
+// to the overflow policy, OverflowSpill blocks as spilled messages would be
+// replayed out of order.
+func (o *ordered) submit(t *task) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if o.closed {
+		o.server.drop(DropPoolClosed, t)
+		return
+	}
+
+	o.startOnce.Do(o.start)
+
+	queue := o.queues[o.key(t)%uint64(len(o.queues))]
+
+	select {
+	case queue <- t:
+		return
+	default:
+	}
+
+	switch o.server.overflow.policy {
+	case OverflowBlock, OverflowSpill:
+		queue <- t
+	case OverflowDropOldest:
+		for {
+			select {
+			case queue <- t:
+				return
+			default:
+			}
+
+			select {
+			case evicted := <-queue:
+				o.server.drop(DropQueueFull, evicted)
+			default:
+			}
+		}
+	default:
+		o.server.drop(DropPoolFull, t)
+	}
+}
+
+// key returns the hash of the connection or the source address of t
+func (o *ordered) key(t *task) uint64 {
+	if o.ordering == OrderPerConnection && t.ctx != nil && t.ctx.id != 0 {
+		return t.ctx.id
+	}
+
+	h := fnv.New64a()
+	if o.ordering == OrderPerSource {
+		host, _, err := net.SplitHostPort(t.client)
+		if err != nil {
+			host = t.client
+		}
+		_, _ = h.Write([]byte(host))
+	} else {
+		// datagram sources of different listeners are different sources
+		_, _ = h.Write([]byte(t.listener.Name()))
+		_, _ = h.Write([]byte(t.client))
+	}
+
+	return h.Sum64()
+}
+
+// stop closes the shards once every queued task is handled
+func (o *ordered) stop() {
+	o.mu.Lock()
+	o.closed = true
+	o.mu.Unlock()
+
+	for _, queue := range o.queues {
+		close(queue)
+	}
+
+	o.wg.Wait()
+}
@@ -0,0 +1,103 @@
+package gsyslog
+
+import (
+	"context"
+	"fmt"
+	"github.com/crazy-airhead/gsyslog/parser"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sequenceHandler records the contents per client, sleeping a bit to shuffle unordered handling
+type sequenceHandler struct {
+	mu        sync.Mutex
+	sequences map[string][]string
+}
+
+func (h *sequenceHandler) Handle(log *parser.Log) {
+	time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client := log.GetString("client")
+	h.sequences[client] = append(h.sequences[client], log.GetString("content"))
+}
+
+func Test_ordered_per_connection(t *testing.T) {
+	handler := &sequenceHandler{sequences: make(map[string][]string)}
+	server := NewServer()
+	server.SetHandler(handler)
+	server.SetCodec(RFC3164Codec)
+	server.SetOrdering(OrderPerConnection)
+	server.SetOrderedShards(4)
+
+	l := NewListener("tcp://127.0.0.1:0")
+	server.AddListener(l)
+
+	const conns, messages = 8, 200
+	ctxs := make([]*connContext, conns)
+	for i := range ctxs {
+		ctxs[i] = &connContext{id: server.connIDs.Add(1)}
+	}
+
+	for m := 0; m < messages; m++ {
+		for c := range ctxs {
+			data := fmt.Sprintf("<34>Oct 11 22:14:15 mymachine su: %d", m)
+			l.dispatch([]byte(data), fmt.Sprintf("127.0.0.1:%d", 40000+c), ctxs[c])
+		}
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handler.sequences) != conns {
+		t.Fatalf("unexpected clients %d", len(handler.sequences))
+	}
+
+	for client, sequence := range handler.sequences {
+		if len(sequence) != messages {
+			t.Fatalf("%s: unexpected %d messages", client, len(sequence))
+		}
+
+		for m, content := range sequence {
+			if content != fmt.Sprint(m) {
+				t.Fatalf("%s: message %d out of order: %s", client, m, content)
+			}
+		}
+	}
+
+	if stats := server.Stats(); stats != (Stats{Received: conns * messages, Handled: conns * messages}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func Test_ordered_key(t *testing.T) {
+	l1 := &Listener{name: "udp"}
+	l2 := &Listener{name: "tcp"}
+
+	o := &ordered{ordering: OrderPerConnection}
+	if o.key(&task{listener: l1, client: "10.0.0.1:1000", ctx: &connContext{id: 7}}) !=
+		o.key(&task{listener: l1, client: "10.0.0.1:2000", ctx: &connContext{id: 7}}) {
+		t.Fatal("messages of a connection must share a key")
+	}
+
+	// datagrams fall back to the source address
+	if o.key(&task{listener: l1, client: "10.0.0.1:1000"}) != o.key(&task{listener: l1, client: "10.0.0.1:1000"}) ||
+		o.key(&task{listener: l1, client: "10.0.0.1:1000"}) == o.key(&task{listener: l2, client: "10.0.0.1:1000"}) {
+		t.Fatal("unexpected datagram keys")
+	}
+
+	o.ordering = OrderPerSource
+	if o.key(&task{listener: l1, client: "10.0.0.1:1000", ctx: &connContext{id: 1}}) !=
+		o.key(&task{listener: l2, client: "10.0.0.1:2000", ctx: &connContext{id: 2}}) {
+		t.Fatal("messages of a source must share a key")
+	}
+
+	if o.key(&task{listener: l1, client: "10.0.0.1:1000"}) == o.key(&task{listener: l1, client: "10.0.0.2:1000"}) {
+		t.Fatal("sources must not share a key")
+	}
+}
@@ -0,0 +1,352 @@
+package gsyslog
+
+import (
+	"errors"
+	"github.com/crazy-airhead/gsyslog/parser"
+	"github.com/panjf2000/ants/v2"
+	"github.com/panjf2000/gnet/v2/pkg/logging"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy tells what to do with a message when the worker pool is saturated
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest drops the message that does not fit in the worker pool
+	OverflowDropNewest OverflowPolicy = iota
+	// OverflowBlock waits for a free worker, which stops reading from the
+	// connections and pushes back on TCP senders
+	OverflowBlock
+	// OverflowDropOldest keeps the messages in a bounded queue, evicting the
+	// oldest one when the queue is full
+	OverflowDropOldest
+	// OverflowSpill writes the messages to spill files, replayed once workers are free
+	OverflowSpill
+)
+
+const (
+	// DefaultOverflowQueueSize is the size of the OverflowDropOldest queue when not set
+	DefaultOverflowQueueSize = 64 * 1024
+
+	// submitRetryInterval is how long to wait before submitting again to a saturated pool
+	submitRetryInterval = time.Millisecond
+)
+
+// DropFunc is called with every dropped message and why it was dropped. It may
+// be called concurrently from any goroutine, the event loops, the workers and
+// the spill drain, so it must be safe for concurrent use and must not block.
+// data is nil when the message could not be read back from a spill file, it
+// must not be kept once DropFunc returns.
+type DropFunc func(reason DropReason, data []byte)
+
+// task is a message waiting to be parsed and handled
+type task struct {
+	listener *Listener
+	data     []byte
+	client   string
+	// ctx holds the peer information of the connection, if any
+	ctx *connContext
+	// buf holds data when it comes from bufferPool
+	buf *[]byte
+	// received when the frame was read
+	received time.Time
+	// local the address the frame was received on
+	local string
+}
+
+// envelope returns how the log of t was received
+func (t *task) envelope() parser.Envelope {
+	envelope := parser.Envelope{
+		ReceivedAt: t.received,
+		Listener:   t.listener.Name(),
+		Transport:  t.listener.network,
+		LocalAddr:  t.local,
+		FrameLen:   len(t.data),
+	}
+
+	if remote, err := netip.ParseAddrPort(t.client); err == nil {
+		envelope.RemoteAddr = remote
+	}
+
+	if t.ctx != nil {
+		envelope.ConnID = t.ctx.id
+	}
+
+	return envelope
+}
+
+// backlog holds the tasks that did not fit in the worker pool, in order
+type backlog interface {
+	// push appends t, returning the task evicted to make room for it, if any
+	push(t *task) (*task, error)
+	// pop removes the oldest task, nil when empty. The error tells how many
+	// tasks were lost when the backlog could not be read.
+	pop() (*task, int, error)
+	len() int
+}
+
+// overflow submits the tasks to the worker pool according to the overflow policy
+type overflow struct {
+	server *Server
+
+	policy    OverflowPolicy
+	queueSize int
+	spillDir  string
+	dropFunc  DropFunc
+
+	mu      sync.Mutex
+	backlog backlog
+	// draining while the backlog is not empty or its last task is not yet
+	// submitted
+	draining bool
+}
+
+// SetOverflowPolicy Sets what to do with messages when the worker pool is
+// saturated, OverflowDropNewest by default
+func (s *Server) SetOverflowPolicy(policy OverflowPolicy) {
+	s.overflow.policy = policy
+}
+
+// SetOverflowQueueSize Sets the size of the OverflowDropOldest queue, and of
+// every shard queue when messages are ordered
+func (s *Server) SetOverflowQueueSize(size int) {
+	s.overflow.queueSize = size
+}
+
+// SetSpillDir Sets the directory of the OverflowSpill files, os.TempDir() by default
+func (s *Server) SetSpillDir(dir string) {
+	s.overflow.spillDir = dir
+}
+
+// SetDropFunc Sets the function called with every dropped message, e.g. to alert
+func (s *Server) SetDropFunc(f DropFunc) {
+	s.overflow.dropFunc = f
+}
+
+// dispatch accounts for the task then submits it
+func (s *Server) dispatch(t *task) {
+	s.accounting.receive()
+
+	if s.ordered.enabled() {
+		s.ordered.submit(t)
+		return
+	}
+
+	s.overflow.submit(t)
+}
+
+// drop accounts for a dropped message and reports it, t is nil when the
+// message could not be read back from a spill file
+func (s *Server) drop(reason DropReason, t *task) {
+	s.accounting.drop(reason)
+
+	if s.overflow.dropFunc != nil {
+		var data []byte
+		if t != nil {
+			data = t.data
+		}
+
+		s.overflow.dropFunc(reason, data)
+	}
+
+	s.release(t)
+}
+
+func (o *overflow) submit(t *task) {
+	// keep the order, nothing goes straight to the pool while messages are
+	// queued or a drained one is being submitted. The check and the enqueue
+	// are done under the same lock, a message enqueued by a concurrent submit
+	// can not be overtaken.
+	o.mu.Lock()
+	if o.draining {
+		o.enqueue(t)
+		o.mu.Unlock()
+		return
+	}
+
+	err := o.server.workerPool.Submit(func() {
+		o.run(t)
+	})
+	if err == nil {
+		o.mu.Unlock()
+		return
+	}
+
+	overload := errors.Is(err, ants.ErrPoolOverload)
+	if overload && (o.policy == OverflowDropOldest || o.policy == OverflowSpill) {
+		o.enqueue(t)
+		o.mu.Unlock()
+		return
+	}
+	o.mu.Unlock()
+
+	switch {
+	case !overload:
+		o.server.drop(DropPoolClosed, t)
+	case o.policy == OverflowBlock:
+		o.submitBlocking(t)
+	default:
+		o.server.drop(DropPoolFull, t)
+	}
+}
+
+// submitBlocking submits t, waiting for a free worker as long as needed
+func (o *overflow) submitBlocking(t *task) {
+	for {
+		err := o.server.workerPool.Submit(func() {
+			o.run(t)
+		})
+		if err == nil {
+			return
+		}
+
+		if !errors.Is(err, ants.ErrPoolOverload) {
+			o.server.drop(DropPoolClosed, t)
+			return
+		}
+
+		time.Sleep(submitRetryInterval)
+	}
+}
+
+// enqueue appends t to the backlog, then makes sure the backlog is drained.
+// It must be called with o.mu held.
+func (o *overflow) enqueue(t *task) {
+	if o.backlog == nil {
+		if o.policy == OverflowSpill {
+			o.backlog = newSpill(o.spillDir, o.server.listenerByName)
+		} else {
+			o.backlog = newQueue(o.queueSize)
+		}
+	}
+
+	evicted, err := o.backlog.push(t)
+	if err != nil {
+		logging.Errorf("syslog spill message failed, error:%v", err)
+		o.server.drop(DropSpillFailed, t)
+		return
+	}
+
+	o.server.accounting.queue()
+
+	if o.policy == OverflowSpill {
+		// the spill file holds a copy of the data
+		o.server.release(t)
+	}
+
+	if evicted != nil {
+		o.server.drop(DropQueueFull, evicted)
+	}
+
+	if !o.draining {
+		o.draining = true
+		go o.drain()
+	}
+}
+
+// drain submits the queued tasks in order until the backlog is empty
+func (o *overflow) drain() {
+	for {
+		o.mu.Lock()
+		t, lost, err := o.backlog.pop()
+		if t == nil && err == nil {
+			o.draining = false
+			o.mu.Unlock()
+			return
+		}
+		o.mu.Unlock()
+
+		if err != nil {
+			logging.Errorf("syslog read spilled messages failed, %d lost, error:%v", lost, err)
+			for i := 0; i < lost; i++ {
+				o.server.drop(DropSpillFailed, nil)
+			}
+		}
+
+		if t != nil {
+			o.submitBlocking(t)
+		}
+	}
+}
+
+// run parses the message on a worker and hands it to the handler
+func (o *overflow) run(t *task) {
+	handled := false
+	var log *parser.Log
+	pooled := false
+	defer func() {
+		if pooled {
+			parser.ReleaseLog(log)
+		}
+
+		if handled {
+			o.server.accounting.handle()
+			o.server.release(t)
+		} else {
+			o.server.drop(DropHandlerPanic, t)
+		}
+	}()
+
+	log, pooled = t.listener.parse(t.data, t.client, t.envelope())
+	if t.ctx != nil {
+		t.ctx.decorate(log)
+	}
+
+	t.listener.transcode(log, t.client)
+
+	handler := t.listener.getHandler()
+	if pooled && !isLazy(handler) {
+		log.Materialize()
+	}
+
+	handler.Handle(log)
+	handled = true
+}
+
+// queue is a bounded in-memory backlog evicting its oldest task when full
+type queue struct {
+	tasks []*task
+	head  int
+	size  int
+}
+
+func newQueue(size int) *queue {
+	if size <= 0 {
+		size = DefaultOverflowQueueSize
+	}
+
+	return &queue{
+		tasks: make([]*task, size),
+	}
+}
+
+func (q *queue) push(t *task) (*task, error) {
+	var evicted *task
+	if q.size == len(q.tasks) {
+		evicted, _, _ = q.pop()
+	}
+
+	q.tasks[(q.head+q.size)%len(q.tasks)] = t
+	q.size++
+
+	return evicted, nil
+}
+
+func (q *queue) pop() (*task, int, error) {
+	if q.size == 0 {
+		return nil, 0, nil
+	}
+
+	t := q.tasks[q.head]
+	q.tasks[q.head] = nil
+	q.head = (q.head + 1) % len(q.tasks)
+	q.size--
+
+	return t, 0, nil
+}
+
+func (q *queue) len() int {
+	return q.size
+}
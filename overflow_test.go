@@ -0,0 +1,275 @@
+package gsyslog
+
+import (
+	"context"
+	"github.com/crazy-airhead/gsyslog/parser"
+	"github.com/panjf2000/ants/v2"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gateHandler records every content and timestamp, blocking until open is closed
+type gateHandler struct {
+	open       chan struct{}
+	mu         sync.Mutex
+	contents   []string
+	timestamps []time.Time
+}
+
+func (h *gateHandler) Handle(log *parser.Log) {
+	<-h.open
+
+	h.mu.Lock()
+	h.contents = append(h.contents, log.GetString("content"))
+	h.timestamps = append(h.timestamps, *log.Syslog.Timestamp)
+	h.mu.Unlock()
+}
+
+// newOverflowServer returns a server with a single worker busy until the handler is opened
+func newOverflowServer(t *testing.T, policy OverflowPolicy) (*Server, *Listener, *gateHandler) {
+	pool, err := ants.NewPool(1, ants.WithNonblocking(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &gateHandler{open: make(chan struct{})}
+	server := NewServer()
+	server.SetWorkerPool(pool)
+	server.SetHandler(handler)
+	server.SetCodec(RFC3164Codec)
+	server.SetOverflowPolicy(policy)
+
+	l := NewListener("tcp://127.0.0.1:0")
+	server.AddListener(l)
+
+	return server, l, handler
+}
+
+func sendContents(l *Listener, contents ...string) {
+	for _, content := range contents {
+		l.dispatch([]byte("<34>Oct 11 22:14:15 mymachine su: "+content), "127.0.0.1:40000", nil)
+	}
+}
+
+func assertOverflow(t *testing.T, server *Server, handler *gateHandler, expected []string, stats Stats) {
+	close(handler.open)
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	if len(handler.contents) != len(expected) {
+		t.Fatalf("unexpected contents %v", handler.contents)
+	}
+
+	for i := range expected {
+		if handler.contents[i] != expected[i] {
+			t.Fatalf("unexpected contents %v", handler.contents)
+		}
+	}
+
+	if got := server.Stats(); got != stats {
+		t.Fatalf("unexpected stats %+v", got)
+	}
+}
+
+func Test_overflow_drop_newest(t *testing.T) {
+	server, l, handler := newOverflowServer(t, OverflowDropNewest)
+
+	var dropped []string
+	server.SetDropFunc(func(reason DropReason, data []byte) {
+		if reason != DropPoolFull {
+			t.Errorf("unexpected reason %v", reason)
+		}
+		dropped = append(dropped, string(data))
+	})
+
+	sendContents(l, "a", "b", "c")
+	if len(dropped) != 2 {
+		t.Fatalf("unexpected drops %v", dropped)
+	}
+
+	assertOverflow(t, server, handler, []string{"a"}, Stats{Received: 3, Handled: 1, Dropped: 2, DroppedPoolFull: 2})
+}
+
+func Test_overflow_drop_oldest(t *testing.T) {
+	server, l, handler := newOverflowServer(t, OverflowDropOldest)
+	server.SetOverflowQueueSize(1)
+
+	sendContents(l, "a", "b", "c", "d", "e")
+	close(handler.open)
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the queue may have been drained into the busy worker once, so "b" may
+	// or may not survive, the first and the newest messages always do
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	n := len(handler.contents)
+	if n < 2 || n > 3 || handler.contents[0] != "a" || handler.contents[n-1] != "e" {
+		t.Fatalf("unexpected contents %v", handler.contents)
+	}
+
+	stats := server.Stats()
+	if stats.Received != 5 || stats.Handled != uint64(n) || stats.Dropped != stats.DroppedQueueFull ||
+		stats.Pending() != 0 || stats.Queued != 4 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func Test_overflow_block(t *testing.T) {
+	server, l, handler := newOverflowServer(t, OverflowBlock)
+
+	sent := make(chan struct{})
+	go func() {
+		sendContents(l, "a", "b", "c")
+		close(sent)
+	}()
+
+	// the second message waits for the busy worker
+	for server.Stats().Received < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case <-sent:
+		t.Fatal("dispatch did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(handler.open)
+	<-sent
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := server.Stats(); got != (Stats{Received: 3, Handled: 3}) {
+		t.Fatalf("unexpected stats %+v", got)
+	}
+}
+
+func Test_overflow_spill(t *testing.T) {
+	dir := t.TempDir()
+	server, l, handler := newOverflowServer(t, OverflowSpill)
+	server.SetSpillDir(dir)
+
+	sendContents(l, "a", "b", "c", "d")
+
+	files, _ := os.ReadDir(dir)
+	if len(files) == 0 {
+		t.Fatal("expected spill files")
+	}
+
+	assertOverflow(t, server, handler, []string{"a", "b", "c", "d"}, Stats{Received: 4, Handled: 4, Queued: 3})
+
+	files, _ = os.ReadDir(dir)
+	if len(files) != 0 {
+		t.Fatalf("spill files left behind: %d", len(files))
+	}
+}
+
+func Test_overflow_spill_release(t *testing.T) {
+	server, l, handler := newOverflowServer(t, OverflowSpill)
+	server.SetSpillDir(t.TempDir())
+	server.SetLogPooling(true)
+
+	tasks := make([]*task, 3)
+	for i, content := range []string{"a", "b", "c"} {
+		data, buf := server.copyDatagram([]byte("<34>Oct 11 22:14:15 mymachine su: " + content))
+		tasks[i] = &task{listener: l, data: data, buf: buf, client: "127.0.0.1:40000"}
+		server.dispatch(tasks[i])
+	}
+
+	// the buffers of the spilled messages go back to the pool once written
+	for _, spilled := range tasks[1:] {
+		if spilled.buf != nil || spilled.data != nil {
+			t.Fatalf("buffer of spilled task %+v not released", spilled)
+		}
+	}
+
+	assertOverflow(t, server, handler, []string{"a", "b", "c"}, Stats{Received: 3, Handled: 3, Queued: 2})
+}
+
+func Test_overflow_received(t *testing.T) {
+	dir := t.TempDir()
+	server, l, handler := newOverflowServer(t, OverflowSpill)
+	server.SetSpillDir(dir)
+
+	// the year is inferred from the receive time, not from the time the
+	// spilled message is read back
+	received := time.Date(2003, 12, 31, 23, 59, 59, 0, time.UTC)
+	for _, content := range []string{"a", "b"} {
+		server.dispatch(&task{
+			listener: l,
+			data:     []byte("<34>Dec 31 23:59:58 mymachine su: " + content),
+			client:   "127.0.0.1:40000",
+			received: received,
+		})
+	}
+
+	assertOverflow(t, server, handler, []string{"a", "b"}, Stats{Received: 2, Handled: 2, Queued: 1})
+
+	for _, ts := range handler.timestamps {
+		if ts.Year() != 2003 {
+			t.Fatalf("unexpected timestamp %s", ts)
+		}
+	}
+}
+
+func Test_spill_segments(t *testing.T) {
+	s := newSpill(t.TempDir(), func(name string) *Listener {
+		return &Listener{name: name}
+	})
+	l := &Listener{name: "tcp"}
+
+	received := time.Unix(0, 1065910455003000000)
+	push := func(content string, ctx *connContext) {
+		pushed := &task{listener: l, data: []byte(content), client: "c", ctx: ctx, received: received}
+		if ctx != nil {
+			pushed.local = ctx.local
+		}
+
+		if _, err := s.push(pushed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pop := func() *task {
+		task, lost, err := s.pop()
+		if err != nil || lost != 0 {
+			t.Fatalf("pop failed, %d lost, error:%v", lost, err)
+		}
+		return task
+	}
+
+	push("a", nil)
+	push("b", &connContext{id: 7, local: "127.0.0.1:6514", cred: &parser.Credential{Pid: 1, Uid: 2, Gid: 3}, subject: "CN=x"})
+
+	// reading closes the first segment, later pushes go to a second one
+	a := pop()
+	push("c", nil)
+	b := pop()
+	c := pop()
+
+	if string(a.data) != "a" || a.ctx != nil || a.listener.Name() != "tcp" || a.client != "c" {
+		t.Fatalf("unexpected task %+v", a)
+	}
+	if string(b.data) != "b" || *b.ctx.cred != (parser.Credential{Pid: 1, Uid: 2, Gid: 3}) || b.ctx.subject != "CN=x" {
+		t.Fatalf("unexpected task %+v", b)
+	}
+	if !b.received.Equal(received) || b.local != "127.0.0.1:6514" || b.ctx.id != 7 || b.ctx.local != b.local {
+		t.Fatalf("unexpected envelope of task %+v", b)
+	}
+	if string(c.data) != "c" {
+		t.Fatalf("unexpected task %+v", c)
+	}
+	if task := pop(); task != nil || s.len() != 0 {
+		t.Fatalf("unexpected task %+v", task)
+	}
+}
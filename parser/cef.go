@@ -0,0 +1,109 @@
+package parser
+
+import "bytes"
+
+// https://www.microfocus.com/documentation/arcsight/arcsight-smartconnectors/pdfdoc/common-event-format-v25/common-event-format-v25.pdf
+
+var (
+	ErrCEFVersion = &Error{Msg: "Invalid CEF version"}
+	ErrCEFHeader  = &Error{Msg: "Missing CEF header field"}
+)
+
+// CEF an ArcSight Common Event Format event,
+// CEF:Version|Device Vendor|Device Product|Device Version|Device Event Class ID|Name|Severity|[Extension]
+type CEF struct {
+	Version       int
+	DeviceVendor  string
+	DeviceProduct string
+	DeviceVersion string
+	// SignatureID the Device Event Class ID
+	SignatureID string
+	Name        string
+	// Severity 0 to 10, or Unknown, Low, Medium, High and Very-High
+	Severity  string
+	Extension Attributes
+}
+
+// ParseCEF parses b, a CEF event. In the header a pipe and a backslash are
+// escaped by a backslash, in the extension an equal sign and a backslash are,
+// while \n and \r are newlines. The values of the extension may have spaces,
+// a key being the word before an unescaped equal sign.
+func ParseCEF(b []byte) (*CEF, *ParseError) {
+	if !bytes.HasPrefix(b, cefPrefix) {
+		return nil, NewParseError(ErrCEFVersion, "cef", b, 0, `"CEF:"`)
+	}
+
+	cursor := len(cefPrefix)
+	to := indexUnescaped(b, cursor, '|')
+	version, ok := ParseDigits(b[cursor:to])
+	if !ok {
+		return nil, NewParseError(ErrCEFVersion, "cef", b, cursor, "version")
+	}
+
+	cef := &CEF{Version: version}
+	cursor, err := parseHeaderFields(b, to, "cef", ErrCEFHeader,
+		&cef.DeviceVendor, &cef.DeviceProduct, &cef.DeviceVersion, &cef.SignatureID, &cef.Name, &cef.Severity)
+	if err != nil {
+		return nil, err
+	}
+
+	cef.Extension = parseExtension(b[cursor:])
+
+	return cef, nil
+}
+
+// parseExtension parses the key=value pairs of b separated by spaces, an
+// equal sign not preceded by a space and a key being part of the value
+func parseExtension(b []byte) Attributes {
+	var attributes Attributes
+
+	// the start of the key and of its value, the last space
+	key, value, space := -1, -1, -1
+	for i := 0; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case ' ':
+			space = i
+		case '=':
+			if space < value || !isExtensionKey(b[space+1:i]) {
+				break
+			}
+
+			if key >= 0 {
+				attributes = appendAttribute(attributes, b[key:value-1], b[value:space])
+			}
+
+			key, value = space+1, i+1
+		}
+	}
+
+	if key >= 0 {
+		attributes = appendAttribute(attributes, b[key:value-1], b[value:])
+	}
+
+	return attributes
+}
+
+func appendAttribute(attributes Attributes, key []byte, value []byte) Attributes {
+	return append(attributes, Attribute{
+		Key:   string(key),
+		Value: unescape(bytes.TrimRight(value, " "), "=\\nr"),
+	})
+}
+
+// isExtensionKey tells whether b is a key of the extension, e.g. src, cs1Label
+// or a vendor key such as ad.EventRecordID
+func isExtensionKey(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+
+	for _, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || IsDigit(c) || c == '_' || c == '.' || c == '-' || c == '[' || c == ']') {
+			return false
+		}
+	}
+
+	return true
+}
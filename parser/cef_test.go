@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+type CEFTestSuite struct {
+}
+
+var _ = Suite(&CEFTestSuite{})
+
+func (s *CEFTestSuite) TestParseCEF(c *C) {
+	fixtures := []struct {
+		event    string
+		expected *CEF
+	}{
+		{
+			"CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 spt=1232",
+			&CEF{
+				DeviceVendor: "Security", DeviceProduct: "threatmanager", DeviceVersion: "1.0",
+				SignatureID: "100", Name: "worm successfully stopped", Severity: "10",
+				Extension: Attributes{{"src", "10.0.0.1"}, {"dst", "2.1.2.2"}, {"spt", "1232"}},
+			},
+		},
+		{
+			// the pipes and the backslashes of the header are escaped
+			`CEF:1|ven\|dor|pro\\duct|1.0|100|a \n b|Very-High|`,
+			&CEF{
+				Version: 1, DeviceVendor: "ven|dor", DeviceProduct: `pro\duct`, DeviceVersion: "1.0",
+				SignatureID: "100", Name: `a \n b`, Severity: "Very-High",
+			},
+		},
+		{
+			// an empty extension
+			"CEF:0|V|P|1.0|100|N|5|",
+			&CEF{DeviceVendor: "V", DeviceProduct: "P", DeviceVersion: "1.0", SignatureID: "100", Name: "N", Severity: "5"},
+		},
+		{
+			// the equal signs and the backslashes of the extension are escaped,
+			// \n and \r are newlines, a pipe needs no escaping
+			`CEF:0|V|P|1.0|100|N|5|msg=a\=b\\c\nd\re|f act=x|y`,
+			&CEF{
+				DeviceVendor: "V", DeviceProduct: "P", DeviceVersion: "1.0", SignatureID: "100", Name: "N", Severity: "5",
+				Extension: Attributes{{"msg", "a=b\\c\nd\re|f"}, {"act", "x|y"}},
+			},
+		},
+		{
+			// the values have spaces, a key being the word before an equal sign
+			"CEF:0|V|P|1.0|100|N|5|msg=hello big world  suser=bob cs1Label=Rule name ad.EventRecordID=7",
+			&CEF{
+				DeviceVendor: "V", DeviceProduct: "P", DeviceVersion: "1.0", SignatureID: "100", Name: "N", Severity: "5",
+				Extension: Attributes{
+					{"msg", "hello big world"}, {"suser", "bob"}, {"cs1Label", "Rule name"}, {"ad.EventRecordID", "7"},
+				},
+			},
+		},
+		{
+			// a key has no space, "bad key" is the end of the value of src and
+			// the key, a word that is not a key is part of the value
+			"CEF:0|V|P|1.0|100|N|5|src=1.2.3.4 bad key=v url=http://x/?a=b c=d",
+			&CEF{
+				DeviceVendor: "V", DeviceProduct: "P", DeviceVersion: "1.0", SignatureID: "100", Name: "N", Severity: "5",
+				Extension: Attributes{{"src", "1.2.3.4 bad"}, {"key", "v"}, {"url", "http://x/?a=b"}, {"c", "d"}},
+			},
+		},
+		{
+			// the text before the first key and a trailing backslash are kept
+			`CEF:0|V|P|1.0|100|N|5|=x no key msg=abc\`,
+			&CEF{
+				DeviceVendor: "V", DeviceProduct: "P", DeviceVersion: "1.0", SignatureID: "100", Name: "N", Severity: "5",
+				Extension: Attributes{{"msg", `abc\`}},
+			},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		cef, err := ParseCEF([]byte(fixture.event))
+
+		comment := Commentf("event %s", fixture.event)
+		c.Assert(err, IsNil, comment)
+		c.Assert(cef, DeepEquals, fixture.expected, comment)
+	}
+}
+
+func (s *CEFTestSuite) TestParseCEF_Invalid(c *C) {
+	fixtures := []struct {
+		event  string
+		err    error
+		offset int
+	}{
+		{"cef:0|V|P|1.0|100|N|5|", ErrCEFVersion, 0},
+		{"CEF:|V|P|1.0|100|N|5|", ErrCEFVersion, 4},
+		{"CEF:x|V|P|1.0|100|N|5|", ErrCEFVersion, 4},
+		{"CEF:0", ErrCEFHeader, 5},
+		// fewer than 7 header fields
+		{"CEF:0|V|P|1.0|100|N", ErrCEFHeader, 19},
+		{"CEF:0|V|P", ErrCEFHeader, 9},
+		// the pipe ending the header is missing, or escaped
+		{"CEF:0|V|P|1.0|100|N|5", ErrCEFHeader, 21},
+		{`CEF:0|V|P|1.0|100|N|5\|src=1`, ErrCEFHeader, 28},
+	}
+
+	for _, fixture := range fixtures {
+		cef, err := ParseCEF([]byte(fixture.event))
+
+		comment := Commentf("event %s", fixture.event)
+		c.Assert(cef, IsNil, comment)
+		c.Assert(errors.Is(err, fixture.err), Equals, true, comment)
+		c.Assert(err.Field, Equals, "cef", comment)
+		c.Assert(err.Offset, Equals, fixture.offset, comment)
+	}
+}
+
+func (s *CEFTestSuite) TestAttributes_Get(c *C) {
+	attributes := Attributes{{"src", "10.0.0.1"}, {"act", "blocked"}, {"src", "10.0.0.2"}}
+
+	value, ok := attributes.Get("src")
+	c.Assert(ok, Equals, true)
+	c.Assert(value, Equals, "10.0.0.1")
+
+	_, ok = attributes.Get("dst")
+	c.Assert(ok, Equals, false)
+}
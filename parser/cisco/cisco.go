@@ -0,0 +1,412 @@
+// Package cisco parses the messages of Cisco IOS, IOS XE, NX-OS and ASA, e.g.
+//
+//	<189>123: *Mar  1 18:46:11.123 UTC: %LINK-3-UPDOWN: Interface Gi0/1, changed state to up
+//	<189>: 2024 Mar  1 18:46:11 UTC: %ETHPORT-5-IF_UP: Interface Ethernet1/1 is up
+//	<166>Mar 01 2024 18:46:11 asa01 : %ASA-6-302013: Built inbound TCP connection
+//
+// The optional sequence number, timestamp and hostname come before the
+// %FACILITY-SEVERITY-MNEMONIC, the content after it.
+package cisco
+
+import (
+	"bytes"
+	"github.com/crazy-airhead/gsyslog/parser"
+	"github.com/crazy-airhead/gsyslog/parser/rfc3164"
+	"net/netip"
+	"time"
+)
+
+// Layouts the timestamps of the Cisco messages, tried in order once the '*' or
+// '.' telling the clock is not synchronized is skipped
+var Layouts = []rfc3164.Layout{
+	rfc3164.TimeLayout("Jan _2 2006 15:04:05 MST"), // Mar  1 2024 18:46:11.123 UTC
+	rfc3164.TimeLayout("Jan _2 2006 15:04:05"),     // Mar 01 2024 18:46:11, ASA
+	rfc3164.TimeLayout("2006 Jan _2 15:04:05 MST"), // 2024 Mar  1 18:46:11 UTC, NX-OS
+	rfc3164.TimeLayout("2006 Jan _2 15:04:05"),     // 2024 Mar  1 18:46:11
+	rfc3164.TimeLayout("Jan _2 15:04:05 MST"),      // Mar  1 18:46:11.123 UTC, IOS
+	rfc3164.TimeLayout(time.Stamp),                 // Mar  1 18:46:11.123
+	rfc3164.TimeLayout(time.RFC3339),               // 2024-03-01T18:46:11Z
+}
+
+type Parser struct {
+	location *time.Location
+	// clock the reference time of the year inference, time.Now when nil
+	clock func() time.Time
+}
+
+func NewParser() *Parser {
+	return &Parser{
+		location: time.UTC,
+	}
+}
+
+func (p *Parser) Location(location *time.Location) {
+	p.location = location
+}
+
+// SetClock Sets the clock giving the reference time of a log, its receive time
+// by default, see rfc3164.Parser.SetClock
+func (p *Parser) SetClock(clock func() time.Time) {
+	p.clock = clock
+}
+
+// now returns the reference time of log, its receive time by default, the
+// current time when it is not known
+func (p *Parser) now(log *parser.Log) time.Time {
+	if p.clock != nil {
+		return p.clock()
+	}
+
+	if received := log.Envelope.ReceivedAt; !received.IsZero() {
+		return received
+	}
+
+	return time.Now()
+}
+
+func (p *Parser) Parse(data []byte, client string) (*parser.Log, error) {
+	log := parser.NewLog(data)
+	err := p.ParseLog(log, client)
+
+	return log, err
+}
+
+// ParseLog parses log.Body into log, see parser.LogParser. The parts that are
+// not recognized are left to the content, so it never fails.
+func (p *Parser) ParseLog(log *parser.Log, client string) error {
+	log.SetClient(client)
+
+	b := log.Body[:log.Len()]
+	cursor := parsePriority(log)
+	cursor = parseSequence(log, b, cursor)
+
+	m := findMnemonic(b, cursor, len(b))
+	if m < 0 {
+		// no header but the timestamp
+		cursor = p.parseHeader(log, b[cursor:], false) + cursor
+		log.SetTag("")
+	} else {
+		p.parseHeader(log, b[cursor:m], true)
+		cursor = parseMnemonic(log, b, m)
+	}
+
+	log.SetContentBytes(bytes.Trim(b[cursor:], " "))
+
+	return nil
+}
+
+// parsePriority returns the cursor after the priority, 0 when there is none
+func parsePriority(log *parser.Log) int {
+	cursor := 0
+	priority, err := parser.ParsePriority(log.Body, &cursor, log.Len())
+	if err != nil {
+		// RFC3164 sec 4.3.3
+		log.SetPriority(13)
+		log.SetFacility(1)
+		log.SetSeverity(5)
+
+		return 0
+	}
+
+	log.SetPriority(priority.P)
+	log.SetFacility(priority.F.Value)
+	log.SetSeverity(priority.S.Value)
+
+	return cursor
+}
+
+// parseSequence parses the sequence number, "123: ", NX-OS sending an empty
+// one, ": ". It returns the cursor after it.
+func parseSequence(log *parser.Log, b []byte, cursor int) int {
+	to := cursor
+	for to < len(b) && parser.IsDigit(b[to]) {
+		to++
+	}
+
+	if to == len(b) || b[to] != ':' || (to+1 < len(b) && b[to+1] != ' ') {
+		return cursor
+	}
+
+	if sequence, ok := parser.ParseDigits(b[cursor:to]); ok {
+		log.SetSequence(sequence)
+	}
+
+	return skipSpaces(b, to+1)
+}
+
+// parseHeader parses the timestamp and the hostname of header, the parts
+// separated by ": ", e.g. "*Mar  1 18:46:11.123 UTC: " or "router1: Mar  1
+// 18:46:11: ". The hostname may also follow the timestamp, "Mar 01 2024
+// 18:46:11 asa01 : ". When the header is not whole, only the timestamp is
+// looked for. It returns the length of the header parsed.
+func (p *Parser) parseHeader(log *parser.Log, header []byte, whole bool) int {
+	now := p.now(log)
+	var hostname []byte
+	var ts time.Time
+	var tsPart []byte
+	parsed := 0
+
+	for from := 0; from < len(header) && tsPart == nil; {
+		to := bytes.Index(header[from:], []byte(": "))
+		if to < 0 {
+			to = len(header)
+		} else {
+			to += from
+		}
+
+		part := bytes.TrimRight(header[from:to], " :")
+		if t, n, ok := p.parseTimestamp(part, p.location, now); ok {
+			ts, tsPart = t, part
+			// "PST: " is an unknown zone, "DMZ : " a hostname
+			rest := bytes.Trim(part[n:], " ")
+			zone := isZone(rest) && to > from && header[to-1] != ' '
+			if whole && hostname == nil && isHostname(rest) && !zone {
+				hostname = rest
+			}
+
+			// the colon ending the timestamp
+			parsed = from + n
+			if parsed < len(header) && header[parsed] == ':' {
+				parsed++
+			}
+			parsed = skipSpaces(header, parsed)
+		} else if !whole {
+			break
+		} else if hostname == nil && isHostname(part) {
+			hostname = part
+		}
+
+		from = skipSpaces(header, min(to+1, len(header)))
+	}
+
+	if whole {
+		parsed = len(header)
+	}
+
+	if hostname != nil {
+		log.SetHostnameBytes(hostname)
+	} else {
+		log.SetHostname(clientHost(log.Syslog.Client))
+	}
+
+	if tsPart == nil {
+		log.SetTimestamp(now.Round(time.Second))
+		return 0
+	}
+
+	if r := log.TimezoneResolver(); r != nil {
+		location := r.Timezone(log.Syslog.Client, log.GetBytes("hostname"))
+		if location != nil && location != p.location {
+			ts, _, _ = p.parseTimestamp(tsPart, location, now)
+		}
+	}
+
+	log.SetTimestamp(ts)
+
+	return parsed
+}
+
+// parseTimestamp parses the timestamp at the start of b, in location unless it
+// has a zone, the year being inferred from now when it has none
+func (p *Parser) parseTimestamp(b []byte, location *time.Location, now time.Time) (time.Time, int, bool) {
+	from := 0
+	if len(b) > 0 && (b[0] == '*' || b[0] == '.') {
+		from = 1
+	}
+
+	for _, layout := range Layouts {
+		ts, n, err := layout.Parse(b[from:], location)
+		if err != nil {
+			continue
+		}
+
+		if ts.Year() == 0 {
+			ts = rfc3164.InferYear(ts, now, 0)
+		}
+
+		return ts, from + n, true
+	}
+
+	return time.Time{}, 0, false
+}
+
+// parseMnemonic parses the %FACILITY-SEVERITY-MNEMONIC: at m, the tag being
+// FACILITY-SEVERITY-MNEMONIC. The numeric mnemonic of ASA is the message ID.
+// It returns the cursor after it.
+func parseMnemonic(log *parser.Log, b []byte, m int) int {
+	to := m + 1
+	for b[to] != ':' {
+		to++
+	}
+
+	token := b[m+1 : to]
+	facility, severity, mnemonic, _ := splitMnemonic(token)
+
+	log.SetTagBytes(token)
+	log.SetCiscoFacilityBytes(facility)
+	log.SetCiscoSeverity(severity)
+	log.SetMnemonicBytes(mnemonic)
+	if _, ok := parser.ParseDigits(mnemonic); ok {
+		log.SetMsgIdBytes(mnemonic)
+	}
+
+	return skipSpaces(b, to+1)
+}
+
+// findMnemonic returns the offset of the first %FACILITY-SEVERITY-MNEMONIC:
+// starting a word of b between from and to, -1 if none
+func findMnemonic(b []byte, from int, to int) int {
+	for i := from; i < to; i++ {
+		if b[i] != '%' || (i > from && b[i-1] != ' ') {
+			continue
+		}
+
+		end := i + 1
+		for end < len(b) && b[end] != ':' && b[end] != ' ' {
+			end++
+		}
+
+		if end == len(b) || b[end] != ':' || (end+1 < len(b) && b[end+1] != ' ') {
+			continue
+		}
+
+		if _, _, _, ok := splitMnemonic(b[i+1 : end]); ok {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// splitMnemonic splits FACILITY-SEVERITY-MNEMONIC, the facility may have a
+// dash, e.g. PM-SP-4-ERR_DISABLE, while the severity is a single digit
+func splitMnemonic(token []byte) (facility []byte, severity int, mnemonic []byte, ok bool) {
+	last := bytes.LastIndexByte(token, '-')
+	if last < 3 || last == len(token)-1 {
+		return nil, 0, nil, false
+	}
+
+	s := token[last-1]
+	if token[last-2] != '-' || s < '0' || s > '7' {
+		return nil, 0, nil, false
+	}
+
+	return token[:last-2], int(s - '0'), token[last+1:], true
+}
+
+// Detect tells whether data is a Cisco message with a
+// %FACILITY-SEVERITY-MNEMONIC: numbered, e.g. "<189>123: " or ": " for NX-OS,
+// starting with the '*' or '.' mark of a clock not synchronized, or with the
+// mnemonic as the first token after the timestamp, "Mar  1 18:46:11.123 UTC: %",
+// and the hostname of ASA, "Mar 01 2024 18:46:11 asa01 : %". Any other message,
+// e.g. RFC3164 with a mnemonic in its content, is not. RFC5424 messages are to
+// be told apart before.
+func Detect(data []byte) bool {
+	cursor := 0
+	if _, err := parser.ParsePriority(data, &cursor, len(data)); err != nil {
+		return false
+	}
+
+	if cursor >= len(data) {
+		return false
+	}
+
+	to := cursor
+	for to < len(data) && parser.IsDigit(data[to]) {
+		to++
+	}
+
+	switch c := data[cursor]; {
+	case to+1 < len(data) && data[to] == ':' && data[to+1] == ' ':
+		// the sequence number, empty for NX-OS
+	case (c == '*' || c == '.') && cursor+1 < len(data) && isLetter(data[cursor+1]):
+	default:
+		return startsWithMnemonic(data, cursor)
+	}
+
+	// the message is parsed by rfc3164 when the Cisco parser finds no mnemonic
+	return findMnemonic(data, cursor, len(data)) >= 0
+}
+
+// startsWithMnemonic tells whether the first token after the timestamp at
+// cursor, or after its unknown zone or the hostname of ASA, is the
+// %FACILITY-SEVERITY-MNEMONIC
+func startsWithMnemonic(data []byte, cursor int) bool {
+	to := bytes.Index(data[cursor:], []byte(": "))
+	if to < 0 {
+		return false
+	}
+	to += cursor
+
+	header := bytes.TrimRight(data[cursor:to], " ")
+	n := -1
+	for _, layout := range Layouts {
+		if _, parsed, err := layout.Parse(header, time.UTC); err == nil {
+			n = parsed
+			break
+		}
+	}
+
+	if n <= 0 {
+		return false
+	}
+
+	// "PST: " is an unknown zone, "asa01 : " a hostname
+	rest := bytes.TrimLeft(header[n:], " ")
+	spaced := len(header) < to-cursor
+	if len(rest) > 0 && (bytes.IndexByte(rest, ' ') >= 0 || (!spaced && !isZone(rest))) {
+		return false
+	}
+
+	m := skipSpaces(data, to+1)
+
+	return m < len(data) && findMnemonic(data, m, m+1) == m
+}
+
+// isHostname tells whether b may be a hostname rather than an uptime, e.g.
+// 1d02h, it is a word not starting with a digit, or an IP
+func isHostname(b []byte) bool {
+	if len(b) == 0 || bytes.IndexByte(b, ' ') >= 0 {
+		return false
+	}
+
+	if !parser.IsDigit(b[0]) {
+		return true
+	}
+
+	_, err := netip.ParseAddr(string(b))
+	return err == nil
+}
+
+// clientHost returns the IP of client, host:port, or client itself
+func clientHost(client string) string {
+	if addrPort, err := netip.ParseAddrPort(client); err == nil {
+		return addrPort.Addr().String()
+	}
+
+	return client
+}
+
+// isZone tells whether b may be the name of the zone of a timestamp, e.g.
+// "PST" of "Mar  1 18:46:11.123 PST: ", left by the layouts when unknown
+func isZone(b []byte) bool {
+	for _, c := range b {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+
+	return len(b) >= 3 && len(b) <= 5
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func skipSpaces(b []byte, cursor int) int {
+	for cursor < len(b) && b[cursor] == ' ' {
+		cursor++
+	}
+
+	return cursor
+}
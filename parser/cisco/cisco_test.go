@@ -0,0 +1,166 @@
+package cisco
+
+import (
+	"github.com/crazy-airhead/gsyslog/parser"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hooks up gocheck into the gotest runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type CiscoTestSuite struct {
+}
+
+var _ = Suite(&CiscoTestSuite{})
+
+func (s *CiscoTestSuite) TestParser_Valid(c *C) {
+	ref := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	fixtures := []struct {
+		log       string
+		timestamp time.Time
+		hostname  string
+		cisco     parser.CiscoMessage
+		msgId     string
+		content   string
+	}{
+		{
+			"<189>123: *Mar  1 18:46:11.123 UTC: %LINK-3-UPDOWN: Interface Gi0/1, changed state to up",
+			time.Date(2024, 3, 1, 18, 46, 11, 123000000, time.UTC), "192.0.2.1",
+			parser.CiscoMessage{Sequence: 123, Facility: "LINK", Severity: 3, Mnemonic: "UPDOWN"},
+			"", "Interface Gi0/1, changed state to up",
+		},
+		{
+			"<189>000045: router1: .Mar  1 2024 18:46:11 UTC: %SYS-5-CONFIG_I: Configured from console",
+			time.Date(2024, 3, 1, 18, 46, 11, 0, time.UTC), "router1",
+			parser.CiscoMessage{Sequence: 45, Facility: "SYS", Severity: 5, Mnemonic: "CONFIG_I"},
+			"", "Configured from console",
+		},
+		{
+			"<189>: 2024 Mar  1 18:46:11 UTC: %ETHPORT-5-IF_UP: Interface Ethernet1/1 is up",
+			time.Date(2024, 3, 1, 18, 46, 11, 0, time.UTC), "192.0.2.1",
+			parser.CiscoMessage{Facility: "ETHPORT", Severity: 5, Mnemonic: "IF_UP"},
+			"", "Interface Ethernet1/1 is up",
+		},
+		{
+			// an unknown zone is not a hostname
+			"<189>126: *Mar  1 18:46:11.123 PST: %LINK-3-UPDOWN: Interface Gi0/1, changed state to up",
+			time.Date(2024, 3, 1, 18, 46, 11, 123000000, time.UTC), "192.0.2.1",
+			parser.CiscoMessage{Sequence: 126, Facility: "LINK", Severity: 3, Mnemonic: "UPDOWN"},
+			"", "Interface Gi0/1, changed state to up",
+		},
+		{
+			"<166>Mar 01 2024 18:46:11 DMZ : %ASA-6-302013: Built inbound TCP connection 1",
+			time.Date(2024, 3, 1, 18, 46, 11, 0, time.UTC), "DMZ",
+			parser.CiscoMessage{Facility: "ASA", Severity: 6, Mnemonic: "302013"},
+			"302013", "Built inbound TCP connection 1",
+		},
+		{
+			"<187>12: 1d02h: %PM-SP-4-ERR_DISABLE: bpduguard error detected on Gi0/2",
+			ref, "192.0.2.1",
+			parser.CiscoMessage{Sequence: 12, Facility: "PM-SP", Severity: 4, Mnemonic: "ERR_DISABLE"},
+			"", "bpduguard error detected on Gi0/2",
+		},
+		{
+			"<166>Mar 01 2024 18:46:11 asa01 : %ASA-6-302013: Built inbound TCP connection 1",
+			time.Date(2024, 3, 1, 18, 46, 11, 0, time.UTC), "asa01",
+			parser.CiscoMessage{Facility: "ASA", Severity: 6, Mnemonic: "302013"},
+			"302013", "Built inbound TCP connection 1",
+		},
+		{
+			"<166>%ASA-6-302013: Built inbound TCP connection 1",
+			ref, "192.0.2.1",
+			parser.CiscoMessage{Facility: "ASA", Severity: 6, Mnemonic: "302013"},
+			"302013", "Built inbound TCP connection 1",
+		},
+		{
+			"<189>125: *Mar  1 18:46:11 no colon",
+			time.Date(2024, 3, 1, 18, 46, 11, 0, time.UTC), "192.0.2.1",
+			parser.CiscoMessage{Sequence: 125},
+			"", "no colon",
+		},
+		{
+			"<189>124: *Mar  1 18:46:11: no mnemonic",
+			time.Date(2024, 3, 1, 18, 46, 11, 0, time.UTC), "192.0.2.1",
+			parser.CiscoMessage{Sequence: 124},
+			"", "no mnemonic",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		p := NewParser()
+		p.SetClock(func() time.Time { return ref })
+
+		obtained, err := p.Parse([]byte(fixture.log), "192.0.2.1:514")
+		c.Assert(err, IsNil)
+
+		comment := Commentf("log %s", fixture.log)
+		c.Assert(*obtained.Syslog.Timestamp, Equals, fixture.timestamp, comment)
+		c.Assert(obtained.GetString("hostname"), Equals, fixture.hostname, comment)
+		c.Assert(obtained.Syslog.Cisco, DeepEquals, fixture.cisco, comment)
+		c.Assert(obtained.GetString("msgId"), Equals, fixture.msgId, comment)
+		c.Assert(obtained.GetString("content"), Equals, fixture.content, comment)
+	}
+}
+
+func (s *CiscoTestSuite) TestParser_ParseLog(c *C) {
+	fixture := "<189>123: *Mar  1 18:46:11.123 UTC: %LINK-3-UPDOWN: Interface Gi0/1, changed state to up"
+
+	expected, err := NewParser().Parse([]byte(fixture), "192.0.2.1:514")
+	c.Assert(err, IsNil)
+	c.Assert(expected.GetString("tag"), Equals, "LINK-3-UPDOWN")
+	c.Assert(expected.Header["sequence"], Equals, 123)
+	c.Assert(expected.Header["ciscoSeverity"], Equals, 3)
+
+	// a pooled log keeps the fields as slices until they are materialized
+	log := parser.AcquireLog([]byte(fixture))
+	c.Assert(NewParser().ParseLog(log, "192.0.2.1:514"), IsNil)
+	c.Assert(log.Header, HasLen, 0)
+	c.Assert(log.GetString("mnemonic"), Equals, "UPDOWN")
+
+	log.Materialize()
+	c.Assert(log.Header, DeepEquals, expected.Header)
+	c.Assert(log.Syslog, DeepEquals, expected.Syslog)
+	parser.ReleaseLog(log)
+}
+
+func (s *CiscoTestSuite) TestDetect(c *C) {
+	fixtures := map[string]bool{
+		"<189>123: *Mar  1 18:46:11.123 UTC: %LINK-3-UPDOWN: up":     true,
+		"<189>*Mar  1 18:46:11.123 UTC: %LINK-3-UPDOWN: up":          true,
+		"<189>: 2024 Mar  1 18:46:11 UTC: %ETHPORT-5-IF_UP: up":      true,
+		"<166>Mar 01 2024 18:46:11: %ASA-6-302013: Built":            true,
+		"<166>Mar 01 2024 18:46:11 asa01 : %ASA-6-302013: Built":     true,
+		"<189>Mar  1 18:46:11.123 PST: %LINK-3-UPDOWN: up":           true,
+		"<187>12: 1d02h: %PM-SP-4-ERR_DISABLE: bpduguard":            true,
+		"<34>Oct 11 22:14:15 mymachine su: 'su root' failed":         false,
+		"<34>Oct 11 22:14:15 mymachine su: %SYS-5-CONFIG in content": false,
+		"no priority %SYS-5-CONFIG_I: x":                             false,
+		// RFC3164 messages with a mnemonic in their content
+		"<13>Mar  1 18:46:11 host app: %FOO-1-BAR: x": false,
+		"<13>Mar  1 18:46:11 host %FOO-1-BAR: x":      false,
+		"<13>Mar  1 18:46:11 host: %FOO-1-BAR: x":     false,
+		"<13>Mar  1 18:46:11 app[12]: %X-1-Y: x":      false,
+		"<13>%FOO-1-BAR: x":                           false,
+		"<13>Mar  1 18:46:11 host app: x %X-1-Y: y":   false,
+		"<13>host app: %X-1-Y: x":                     false,
+		// numbered but without mnemonic, left to rfc3164
+		"<189>125: *Mar  1 18:46:11 no colon":    false,
+		"<189>*Mar  1 18:46:11.123 UTC: link up": false,
+	}
+
+	for log, expected := range fixtures {
+		c.Assert(Detect([]byte(log)), Equals, expected, Commentf("log %s", log))
+	}
+}
+
+func (s *CiscoTestSuite) TestParser_Received(c *C) {
+	// the year is inferred from the receive time
+	log := parser.NewLog([]byte("<189>123: *Dec 31 23:59:59.123 UTC: %LINK-3-UPDOWN: up"))
+	log.SetEnvelope(parser.Envelope{ReceivedAt: time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC)})
+	c.Assert(NewParser().ParseLog(log, "192.0.2.1:514"), IsNil)
+	c.Assert(*log.Syslog.Timestamp, Equals, time.Date(2023, 12, 31, 23, 59, 59, 123000000, time.UTC))
+}
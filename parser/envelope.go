@@ -0,0 +1,27 @@
+package parser
+
+import (
+	"net/netip"
+	"time"
+)
+
+// Envelope tells how a log was received, it is set by the server, whatever
+// the format of the log
+type Envelope struct {
+	// ReceivedAt when the frame was read, with the monotonic clock reading of
+	// time.Now, lost by the logs spilled to disk
+	ReceivedAt time.Time
+	// Listener the name of the listener that received the log
+	Listener string
+	// Transport the network of the listener: udp, tcp, tls, unix or unixgram
+	Transport string
+	// LocalAddr the address the log was received on, a path for unix sockets
+	LocalAddr string
+	// RemoteAddr the IP and port of the sender, invalid for unix sockets
+	RemoteAddr netip.AddrPort
+	// ConnID the id of the stream connection, unique within the server, 0 for
+	// datagrams
+	ConnID uint64
+	// FrameLen the length of the raw frame, before any transcoding
+	FrameLen int
+}
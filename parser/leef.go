@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"bytes"
+	"strconv"
+	"unicode/utf8"
+)
+
+// https://www.ibm.com/docs/en/dsm?topic=leef-overview
+
+var (
+	ErrLEEFVersion   = &Error{Msg: "Invalid LEEF version"}
+	ErrLEEFHeader    = &Error{Msg: "Missing LEEF header field"}
+	ErrLEEFDelimiter = &Error{Msg: "Invalid LEEF delimiter"}
+)
+
+// DefaultLEEFDelimiter the delimiter of the LEEF 1.0 attributes, and of the
+// LEEF 2.0 ones when none is set
+const DefaultLEEFDelimiter = '\t'
+
+// LEEF an IBM QRadar Log Event Extended Format event,
+// LEEF:Version|Vendor|Product|Version|EventID|[Delimiter|]Attributes, the
+// delimiter being set by LEEF 2.0 only
+type LEEF struct {
+	// Version 1.0 or 2.0
+	Version        string
+	Vendor         string
+	Product        string
+	ProductVersion string
+	EventID        string
+	// Delimiter the delimiter of the attributes, a tab by default
+	Delimiter  rune
+	Attributes Attributes
+}
+
+// ParseLEEF parses b, a LEEF event. In the header a pipe is escaped by a
+// backslash. The delimiter of LEEF 2.0 is a character or its code point in
+// hex, e.g. ^, x09 or 0x09, the attributes being split by it. A value may have
+// any character but the delimiter.
+func ParseLEEF(b []byte) (*LEEF, *ParseError) {
+	if !bytes.HasPrefix(b, leefPrefix) {
+		return nil, NewParseError(ErrLEEFVersion, "leef", b, 0, `"LEEF:"`)
+	}
+
+	cursor := len(leefPrefix)
+	to := indexUnescaped(b, cursor, '|')
+	version := b[cursor:to]
+	if !isLEEFVersion(version) {
+		return nil, NewParseError(ErrLEEFVersion, "leef", b, cursor, "version")
+	}
+
+	leef := &LEEF{Version: string(version), Delimiter: DefaultLEEFDelimiter}
+	cursor, err := parseHeaderFields(b, to, "leef", ErrLEEFHeader,
+		&leef.Vendor, &leef.Product, &leef.ProductVersion, &leef.EventID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the delimiter of LEEF 2.0 is a header field, the attributes follow
+	// right away when it is left out
+	if version[0] != '1' {
+		to = indexUnescaped(b, cursor, '|')
+		if to < len(b) && bytes.IndexByte(b[cursor:to], '=') < 0 {
+			delimiter, ok := parseLEEFDelimiter(b[cursor:to])
+			if !ok {
+				return nil, NewParseError(ErrLEEFDelimiter, "leef", b, cursor, "DELIMITER")
+			}
+
+			leef.Delimiter = delimiter
+			cursor = to + 1
+		}
+	}
+
+	leef.Attributes = parseLEEFAttributes(b[cursor:], leef.Delimiter)
+
+	return leef, nil
+}
+
+// isLEEFVersion tells whether b is a version, e.g. 1.0 or 2.0
+func isLEEFVersion(b []byte) bool {
+	if len(b) == 0 || !IsDigit(b[0]) {
+		return false
+	}
+
+	for _, c := range b {
+		if !IsDigit(c) && c != '.' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseLEEFDelimiter parses the delimiter field of LEEF 2.0, a character or
+// x or 0x followed by its code point in hex, the default one when empty
+func parseLEEFDelimiter(b []byte) (rune, bool) {
+	switch len(b) {
+	case 0:
+		return DefaultLEEFDelimiter, true
+	case 1:
+		// Latin-1 when not ASCII, e.g. ¦
+		return rune(b[0]), true
+	}
+
+	if r, size := utf8.DecodeRune(b); r != utf8.RuneError && size == len(b) {
+		return r, true
+	}
+
+	hex := b
+	if len(hex) > 2 && hex[0] == '0' {
+		hex = hex[1:]
+	}
+
+	if hex[0] != 'x' && hex[0] != 'X' {
+		return 0, false
+	}
+
+	code, err := strconv.ParseUint(string(hex[1:]), 16, 32)
+	if err != nil || code == 0 || !utf8.ValidRune(rune(code)) {
+		return 0, false
+	}
+
+	return rune(code), true
+}
+
+// parseLEEFAttributes parses the key=value pairs of b separated by delimiter,
+// the key ending at the first equal sign. A pair without a key is left out.
+func parseLEEFAttributes(b []byte, delimiter rune) Attributes {
+	var attributes Attributes
+
+	sep := []byte(string(delimiter))
+	if delimiter < 0x100 && !bytes.Contains(b, sep) {
+		// a Latin-1 delimiter sent as is, e.g. xa6
+		sep = []byte{byte(delimiter)}
+	}
+
+	for len(b) > 0 {
+		pair := b
+		if i := bytes.Index(b, sep); i >= 0 {
+			pair, b = b[:i], b[i+len(sep):]
+		} else {
+			b = nil
+		}
+
+		eq := bytes.IndexByte(pair, '=')
+		if eq <= 0 {
+			continue
+		}
+
+		attributes = append(attributes, Attribute{
+			Key:   string(bytes.Trim(pair[:eq], " ")),
+			Value: string(pair[eq+1:]),
+		})
+	}
+
+	return attributes
+}
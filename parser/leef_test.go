@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+type LEEFTestSuite struct {
+}
+
+var _ = Suite(&LEEFTestSuite{})
+
+func (s *LEEFTestSuite) TestParseLEEF(c *C) {
+	fixtures := []struct {
+		event    string
+		expected *LEEF
+	}{
+		{
+			// LEEF 1.0 attributes are separated by tabs
+			"LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=192.0.2.1\tdst=172.50.123.1\tsev=5",
+			&LEEF{
+				Version: "1.0", Vendor: "Microsoft", Product: "MSExchange", ProductVersion: "4.0 SP1", EventID: "15345",
+				Delimiter:  '\t',
+				Attributes: Attributes{{"src", "192.0.2.1"}, {"dst", "172.50.123.1"}, {"sev", "5"}},
+			},
+		},
+		{
+			// LEEF 1.0 has no delimiter field, a caret is part of the value
+			"LEEF:1.0|V|P|1.0|100|msg=a^b\tusr=c d",
+			&LEEF{
+				Version: "1.0", Vendor: "V", Product: "P", ProductVersion: "1.0", EventID: "100",
+				Delimiter:  '\t',
+				Attributes: Attributes{{"msg", "a^b"}, {"usr", "c d"}},
+			},
+		},
+		{
+			"LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5^sev=5",
+			&LEEF{
+				Version: "2.0", Vendor: "Lancope", Product: "StealthWatch", ProductVersion: "1.0", EventID: "41",
+				Delimiter:  '^',
+				Attributes: Attributes{{"src", "10.0.1.8"}, {"dst", "10.0.0.5"}, {"sev", "5"}},
+			},
+		},
+		{
+			// the delimiter in hex, with or without 0
+			"LEEF:2.0|V|P|1.0|100|x09|src=1\tdst=2",
+			&LEEF{
+				Version: "2.0", Vendor: "V", Product: "P", ProductVersion: "1.0", EventID: "100",
+				Delimiter:  '\t',
+				Attributes: Attributes{{"src", "1"}, {"dst", "2"}},
+			},
+		},
+		{
+			"LEEF:2.0|V|P|1.0|100|0x7C|src=1|dst=2",
+			&LEEF{
+				Version: "2.0", Vendor: "V", Product: "P", ProductVersion: "1.0", EventID: "100",
+				Delimiter:  '|',
+				Attributes: Attributes{{"src", "1"}, {"dst", "2"}},
+			},
+		},
+		{
+			// a Latin-1 delimiter sent as is or in UTF-8
+			"LEEF:2.0|V|P|1.0|100|xa6|src=1\xa6dst=2",
+			&LEEF{
+				Version: "2.0", Vendor: "V", Product: "P", ProductVersion: "1.0", EventID: "100",
+				Delimiter:  '¦',
+				Attributes: Attributes{{"src", "1"}, {"dst", "2"}},
+			},
+		},
+		{
+			"LEEF:2.0|V|P|1.0|100|¦|src=1¦dst=2",
+			&LEEF{
+				Version: "2.0", Vendor: "V", Product: "P", ProductVersion: "1.0", EventID: "100",
+				Delimiter:  '¦',
+				Attributes: Attributes{{"src", "1"}, {"dst", "2"}},
+			},
+		},
+		{
+			// the delimiter field is left out, or empty
+			"LEEF:2.0|V|P|1.0|100|src=1\tdst=2",
+			&LEEF{
+				Version: "2.0", Vendor: "V", Product: "P", ProductVersion: "1.0", EventID: "100",
+				Delimiter:  '\t',
+				Attributes: Attributes{{"src", "1"}, {"dst", "2"}},
+			},
+		},
+		{
+			"LEEF:2.0|V|P|1.0|100||src=1\tdst=2",
+			&LEEF{
+				Version: "2.0", Vendor: "V", Product: "P", ProductVersion: "1.0", EventID: "100",
+				Delimiter:  '\t',
+				Attributes: Attributes{{"src", "1"}, {"dst", "2"}},
+			},
+		},
+		{
+			// a pipe of the header is escaped, a pair without key is left out
+			`LEEF:1.0|ven\|dor|P|1.0|100|=x` + "\tnokey\t key =a=b\t",
+			&LEEF{
+				Version: "1.0", Vendor: "ven|dor", Product: "P", ProductVersion: "1.0", EventID: "100",
+				Delimiter:  '\t',
+				Attributes: Attributes{{"key", "a=b"}},
+			},
+		},
+		{
+			// no attributes
+			"LEEF:1.0|V|P|1.0|100|",
+			&LEEF{Version: "1.0", Vendor: "V", Product: "P", ProductVersion: "1.0", EventID: "100", Delimiter: '\t'},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		leef, err := ParseLEEF([]byte(fixture.event))
+
+		comment := Commentf("event %s", fixture.event)
+		c.Assert(err, IsNil, comment)
+		c.Assert(leef, DeepEquals, fixture.expected, comment)
+	}
+}
+
+func (s *LEEFTestSuite) TestParseLEEF_Invalid(c *C) {
+	fixtures := []struct {
+		event  string
+		err    error
+		offset int
+	}{
+		{"leef:1.0|V|P|1.0|100|", ErrLEEFVersion, 0},
+		// the version is missing or is not a number
+		{"LEEF:|V|P|1.0|100|", ErrLEEFVersion, 5},
+		{"LEEF:V|P|1.0|100|", ErrLEEFVersion, 5},
+		{"LEEF:v2|V|P|1.0|100|", ErrLEEFVersion, 5},
+		// fewer header fields
+		{"LEEF:1.0|V|P|1.0", ErrLEEFHeader, 16},
+		{"LEEF:1.0|V|P|1.0|100", ErrLEEFHeader, 20},
+		{"LEEF:2.0", ErrLEEFHeader, 8},
+		// the delimiter is neither a character nor its code point in hex
+		{"LEEF:2.0|V|P|1.0|100|tab|src=1", ErrLEEFDelimiter, 21},
+		{"LEEF:2.0|V|P|1.0|100|x0|src=1", ErrLEEFDelimiter, 21},
+		{"LEEF:2.0|V|P|1.0|100|xzz|src=1", ErrLEEFDelimiter, 21},
+	}
+
+	for _, fixture := range fixtures {
+		leef, err := ParseLEEF([]byte(fixture.event))
+
+		comment := Commentf("event %s", fixture.event)
+		c.Assert(leef, IsNil, comment)
+		c.Assert(errors.Is(err, fixture.err), Equals, true, comment)
+		c.Assert(err.Field, Equals, "leef", comment)
+		c.Assert(err.Offset, Equals, fixture.offset, comment)
+	}
+}
@@ -1,19 +1,71 @@
 package parser
 
-import "time"
+import (
+	"time"
+)
 
 const (
 	LogBody = "body"
 )
 
+// key of a field set by the parsers, see Log.lazy
+type key uint
+
+const (
+	keyPriority key = iota
+	keyFacility
+	keySeverity
+	keyVersion
+	keyTimestamp
+	keyHostname
+	keyAppName
+	keyProcId
+	keyMsgId
+	keyStructuredData
+	keyTag
+	keyContent
+	keyMessage
+	keyClient
+	keySequence
+	keyCiscoFacility
+	keyCiscoSeverity
+	keyMnemonic
+	keys
+)
+
+var (
+	// rawKeys the Header keys of the fields kept as byte slices by a pooled Log
+	rawKeys = map[string]key{
+		"hostname":       keyHostname,
+		"appName":        keyAppName,
+		"procId":         keyProcId,
+		"msgId":          keyMsgId,
+		"structuredData": keyStructuredData,
+		"tag":            keyTag,
+		"content":        keyContent,
+		"message":        keyMessage,
+		"ciscoFacility":  keyCiscoFacility,
+		"mnemonic":       keyMnemonic,
+	}
+
+	emptyBytes = []byte{}
+)
+
 type Log struct {
 	// 结构化的数据
 	Header map[string]interface{} `json:"header"`
 	// 原始数据
 	Body []byte `json:"body"`
 
-	// 是否有错，有错时结构化数据不可能
+	// 强类型的结构化数据，与 Header 同时由 SetXxx 方法填充
+	Syslog SyslogMessage `json:"-"`
+	// 接收时间、监听器、传输协议、地址等来源信息，由 Server 填充
+	Envelope Envelope `json:"-"`
+
+	// 是否有错，有错时结构化数据不可能。解析器的错误为 *ParseError，包含字段、偏移及期望与实际的字节
 	Err error
+	// 宽松模式下解析时容忍的不符合 RFC 的地方，按出现的顺序
+	Warnings []*ParseError
 
 	// 辅助解析用，解析的过程中cursor会发生变化
 	cursor int
@@ -21,12 +73,39 @@ type Log struct {
 	len int
 	// 是否忽略标签
 	skipTag bool
+
+	// Syslog.Timestamp 指向该字段，避免每条日志分配一次
+	timestamp time.Time
+
+	// 来自 AcquireLog 的日志，字段以 Body 的切片保存，需要字符串时才转换，见 Materialize；
+	// 转换前 Syslog 的字符串字段（Hostname、AppName、Tag、Message 等）为空
+	pooled bool
+	// pooled 时已设置的字段
+	set uint32
+	// pooled 时字符串字段的原始数据
+	raw [keys][]byte
+	// pooled 时 STRUCTURED-DATA 是否已解析
+	sdParsed bool
+
+	// 解析没有时区的时间戳时使用，为 nil 时使用解析器的时区
+	timezones TimezoneResolver
+
+	// CEF、LEEF 等载荷在 Body 中的偏移，转码后重新解析时使用，见 ReparsePayload
+	payload int
+}
+
+// Credential of the process that sent a log over a unix socket
+type Credential struct {
+	Pid int
+	Uid int
+	Gid int
 }
 
 func NewLog(body []byte) *Log {
 	return &Log{
 		Header: make(map[string]interface{}),
 		Body:   body,
+		Syslog: SyslogMessage{Version: NoVersion},
 		cursor: 0,
 		len:    len(body),
 	}
@@ -40,6 +119,7 @@ func NewLogWith(header map[string]interface{}, body []byte) *Log {
 	return &Log{
 		Header: header,
 		Body:   body,
+		Syslog: SyslogMessage{Version: NoVersion},
 	}
 }
 
@@ -63,6 +143,22 @@ func (l *Log) Len() int {
 	return l.len
 }
 
+// AddWarning records err, tolerated by the parsing
+func (l *Log) AddWarning(err *ParseError) {
+	l.Warnings = append(l.Warnings, err)
+}
+
+// SetTimezoneResolver Sets the resolver of the timezone of the timestamps
+// without a zone, to be called before parsing
+func (l *Log) SetTimezoneResolver(r TimezoneResolver) {
+	l.timezones = r
+}
+
+// TimezoneResolver returns the resolver set by SetTimezoneResolver, nil if none
+func (l *Log) TimezoneResolver() TimezoneResolver {
+	return l.timezones
+}
+
 func (l *Log) SetSkipTag(skipTag bool) {
 	l.skipTag = skipTag
 }
@@ -72,77 +168,366 @@ func (l *Log) SkipTag() bool {
 }
 
 func (l *Log) Set(key string, val interface{}) {
+	l.Materialize()
 	l.Header[key] = val
 }
 
+// lazy records that k is set on a pooled Log, it is added to the Header by
+// Materialize. It returns false when the Log is not pooled.
+func (l *Log) lazy(k key) bool {
+	if !l.pooled {
+		return false
+	}
+
+	l.set |= 1 << k
+	return true
+}
+
+// setRaw keeps the string field k as is on a pooled Log, it returns false when
+// the Log is not pooled
+func (l *Log) setRaw(k key, b []byte) bool {
+	if !l.lazy(k) {
+		return false
+	}
+
+	if b == nil {
+		b = emptyBytes
+	}
+
+	l.raw[k] = b
+	return true
+}
+
 // SetPriority rfc316 rfc5424
 func (l *Log) SetPriority(priority int) {
+	l.Syslog.Priority = priority
+	if l.lazy(keyPriority) {
+		return
+	}
+
 	l.Set("priority", priority)
 }
 
 // SetFacility  rfc316 rfc5424
 func (l *Log) SetFacility(facility int) {
+	l.Syslog.Facility = facility
+	if l.lazy(keyFacility) {
+		return
+	}
+
 	l.Set("facility", facility)
 }
 
 // SetSeverity  rfc316 rfc5424
 func (l *Log) SetSeverity(severity int) {
+	l.Syslog.Severity = severity
+	if l.lazy(keySeverity) {
+		return
+	}
+
 	l.Set("severity", severity)
 }
 
 // SetTag  rfc316 rfc5424
 func (l *Log) SetTag(tag string) {
+	if l.setRaw(keyTag, []byte(tag)) {
+		return
+	}
+
 	l.Set("tag", tag)
+	l.Syslog.Tag = tag
+}
+
+// SetTagBytes  rfc316, see SetHostnameBytes
+func (l *Log) SetTagBytes(tag []byte) {
+	if l.setRaw(keyTag, tag) {
+		return
+	}
+
+	l.SetTag(string(tag))
 }
 
 // SetClient  rfc316 rfc5424
 func (l *Log) SetClient(client string) {
+	l.Syslog.Client = client
+	if l.lazy(keyClient) {
+		return
+	}
+
 	l.Set("client", client)
 }
 
+// SetCEF  the CEF event of the message, set right away, even on a pooled Log
+func (l *Log) SetCEF(cef *CEF) {
+	l.Syslog.CEF = cef
+}
+
+// SetLEEF  the LEEF event of the message, set right away, even on a pooled Log
+func (l *Log) SetLEEF(leef *LEEF) {
+	l.Syslog.LEEF = leef
+}
+
+// SetEnvelope  how the log was received, set by the server
+func (l *Log) SetEnvelope(envelope Envelope) {
+	l.Envelope = envelope
+}
+
+// SetPeerSubject  tls, subject of the client certificate
+func (l *Log) SetPeerSubject(subject string) {
+	// set right away, even on a pooled Log
+	l.Header["peerSubject"] = subject
+}
+
+// SetPeerCred  unix, credentials of the sending process
+func (l *Log) SetPeerCred(cred Credential) {
+	l.Header["peerCred"] = cred
+}
+
 // SetHostname  rfc316 rfc5424
 func (l *Log) SetHostname(hostname string) {
+	if l.setRaw(keyHostname, []byte(hostname)) {
+		return
+	}
+
 	l.Set("hostname", hostname)
+	l.Syslog.Hostname = nilOr(hostname)
+}
+
+// SetHostnameBytes  rfc316 rfc5424, a pooled Log keeps hostname as is until a
+// string is asked for, any other Log sets it as a string
+func (l *Log) SetHostnameBytes(hostname []byte) {
+	if l.setRaw(keyHostname, hostname) {
+		return
+	}
+
+	l.SetHostname(string(hostname))
 }
 
 // SetTimestamp  rfc316 rfc5424
 func (l *Log) SetTimestamp(timestamp time.Time) {
+	l.timestamp = timestamp
+	l.Syslog.Timestamp = &l.timestamp
+	if l.lazy(keyTimestamp) {
+		return
+	}
+
 	l.Set("timestamp", timestamp)
 }
 
 // SetContent  rfc316
 func (l *Log) SetContent(content string) {
+	if l.setRaw(keyContent, []byte(content)) {
+		return
+	}
+
 	l.Set("content", content)
+	l.Syslog.Message = content
+}
+
+// SetContentBytes  rfc316, see SetHostnameBytes
+func (l *Log) SetContentBytes(content []byte) {
+	if l.setRaw(keyContent, content) {
+		return
+	}
+
+	l.SetContent(string(content))
 }
 
 // SetVersion  rfc5424
 func (l *Log) SetVersion(version int) {
+	l.Syslog.Version = version
+	if l.lazy(keyVersion) {
+		return
+	}
+
 	l.Set("version", version)
 }
 
 // SetAppName  rfc5424
 func (l *Log) SetAppName(appName string) {
+	if l.setRaw(keyAppName, []byte(appName)) {
+		return
+	}
+
 	l.Set("appName", appName)
+	l.Syslog.AppName = nilOr(appName)
+}
+
+// SetAppNameBytes  rfc5424, see SetHostnameBytes
+func (l *Log) SetAppNameBytes(appName []byte) {
+	if l.setRaw(keyAppName, appName) {
+		return
+	}
+
+	l.SetAppName(string(appName))
 }
 
-// SetProcId  rfc5424
+// SetProcId  rfc5424, rfc3164 PID of the tag
 func (l *Log) SetProcId(procId string) {
+	if l.setRaw(keyProcId, []byte(procId)) {
+		return
+	}
+
 	l.Set("procId", procId)
+	l.Syslog.ProcID = nilOr(procId)
+}
+
+// SetProcIdBytes  rfc5424, see SetHostnameBytes
+func (l *Log) SetProcIdBytes(procId []byte) {
+	if l.setRaw(keyProcId, procId) {
+		return
+	}
+
+	l.SetProcId(string(procId))
 }
 
 // SetMsgId rfc5424
 func (l *Log) SetMsgId(msgId string) {
+	if l.setRaw(keyMsgId, []byte(msgId)) {
+		return
+	}
+
 	l.Set("msgId", msgId)
+	l.Syslog.MsgID = nilOr(msgId)
+}
+
+// SetMsgIdBytes  rfc5424, see SetHostnameBytes
+func (l *Log) SetMsgIdBytes(msgId []byte) {
+	if l.setRaw(keyMsgId, msgId) {
+		return
+	}
+
+	l.SetMsgId(string(msgId))
 }
 
 // SetStructuredData rfc5424
 func (l *Log) SetStructuredData(structuredData string) {
+	if l.setRaw(keyStructuredData, []byte(structuredData)) {
+		return
+	}
+
 	l.Set("structuredData", structuredData)
 }
 
+// SetStructuredDataBytes rfc5424, the raw STRUCTURED-DATA, already checked by
+// ScanStructuredData. Its elements are parsed right away, or when asked for by
+// a pooled Log.
+func (l *Log) SetStructuredDataBytes(structuredData []byte) {
+	if l.setRaw(keyStructuredData, structuredData) {
+		return
+	}
+
+	l.SetStructuredData(string(structuredData))
+
+	cursor := 0
+	sd, _ := ParseStructuredData(structuredData, &cursor, len(structuredData))
+	l.SetStructuredElements(sd)
+}
+
+// SetStructuredElements rfc5424, the parsed elements of the structured data
+func (l *Log) SetStructuredElements(sd StructuredData) {
+	l.Syslog.StructuredData = sd
+	l.sdParsed = true
+}
+
+// StructuredData rfc5424, the parsed elements of the structured data, nil for "-"
+func (l *Log) StructuredData() StructuredData {
+	if l.pooled && !l.sdParsed {
+		raw := l.raw[keyStructuredData]
+		cursor := 0
+		sd, _ := ParseStructuredData(raw, &cursor, len(raw))
+		l.SetStructuredElements(sd)
+	}
+
+	return l.Syslog.StructuredData
+}
+
+// SDParam rfc5424, the value of the first param named name of the element id,
+// e.g. log.SDParam("exampleSDID@32473", "eventID")
+func (l *Log) SDParam(id string, name string) (string, bool) {
+	return l.StructuredData().Param(id, name)
+}
+
 // SetMessage rfc5424
 func (l *Log) SetMessage(message string) {
+	if l.setRaw(keyMessage, []byte(message)) {
+		return
+	}
+
 	l.Set("message", message)
+	l.Syslog.Message = message
+}
+
+// SetMessageBytes  rfc5424, see SetHostnameBytes
+func (l *Log) SetMessageBytes(message []byte) {
+	if l.setRaw(keyMessage, message) {
+		return
+	}
+
+	l.SetMessage(string(message))
+}
+
+// SetUTF8 rfc5424, whether MSG is declared UTF-8 by the BOM
+func (l *Log) SetUTF8(utf8 bool) {
+	l.Syslog.UTF8 = utf8
+}
+
+// SetSequence cisco, the sequence number of the message
+func (l *Log) SetSequence(sequence int) {
+	l.Syslog.Cisco.Sequence = sequence
+	if l.lazy(keySequence) {
+		return
+	}
+
+	l.Set("sequence", sequence)
+}
+
+// SetCiscoFacility cisco, the FACILITY of %FACILITY-SEVERITY-MNEMONIC
+func (l *Log) SetCiscoFacility(facility string) {
+	if l.setRaw(keyCiscoFacility, []byte(facility)) {
+		return
+	}
+
+	l.Set("ciscoFacility", facility)
+	l.Syslog.Cisco.Facility = facility
+}
+
+// SetCiscoFacilityBytes cisco, see SetHostnameBytes
+func (l *Log) SetCiscoFacilityBytes(facility []byte) {
+	if l.setRaw(keyCiscoFacility, facility) {
+		return
+	}
+
+	l.SetCiscoFacility(string(facility))
+}
+
+// SetCiscoSeverity cisco, the SEVERITY of %FACILITY-SEVERITY-MNEMONIC
+func (l *Log) SetCiscoSeverity(severity int) {
+	l.Syslog.Cisco.Severity = severity
+	if l.lazy(keyCiscoSeverity) {
+		return
+	}
+
+	l.Set("ciscoSeverity", severity)
+}
+
+// SetMnemonic cisco, the MNEMONIC of %FACILITY-SEVERITY-MNEMONIC
+func (l *Log) SetMnemonic(mnemonic string) {
+	if l.setRaw(keyMnemonic, []byte(mnemonic)) {
+		return
+	}
+
+	l.Set("mnemonic", mnemonic)
+	l.Syslog.Cisco.Mnemonic = mnemonic
+}
+
+// SetMnemonicBytes cisco, see SetHostnameBytes
+func (l *Log) SetMnemonicBytes(mnemonic []byte) {
+	if l.setRaw(keyMnemonic, mnemonic) {
+		return
+	}
+
+	l.SetMnemonic(string(mnemonic))
 }
 
 func (l *Log) Get(key string) interface{} {
@@ -151,6 +536,8 @@ func (l *Log) Get(key string) interface{} {
 		return l.Body
 	}
 
+	l.Materialize()
+
 	// then get from header
 	return l.Header[key]
 }
@@ -161,6 +548,14 @@ func (l *Log) GetString(key string) string {
 		return string(l.Body)
 	}
 
+	if l.pooled {
+		if k, ok := rawKeys[key]; ok && l.raw[k] != nil {
+			return string(l.raw[k])
+		}
+
+		l.Materialize()
+	}
+
 	// then get from header
 	val := l.Header[key]
 	if s, ok := (val).(string); ok {
@@ -169,3 +564,24 @@ func (l *Log) GetString(key string) string {
 
 	return ""
 }
+
+// GetBytes returns the string field key, a pooled Log returns it without a
+// copy, the slice is then only valid until the Log is released
+func (l *Log) GetBytes(key string) []byte {
+	if key == LogBody {
+		return l.Body
+	}
+
+	if l.pooled {
+		if k, ok := rawKeys[key]; ok && l.raw[k] != nil {
+			return l.raw[k]
+		}
+	}
+
+	s := l.GetString(key)
+	if s == "" {
+		return nil
+	}
+
+	return []byte(s)
+}
@@ -0,0 +1,68 @@
+package parser
+
+import "time"
+
+// SyslogMessage is the typed view of a parsed log, filled along with the
+// Header map by the Set methods of Log. Pointer fields are nil when the field
+// is absent or NILVALUE ("-").
+type SyslogMessage struct {
+	Priority int
+	Facility int
+	Severity int
+	// Version rfc5424, NoVersion for rfc3164
+	Version int
+
+	Timestamp *time.Time
+	Hostname  *string
+	// AppName rfc5424
+	AppName *string
+	// ProcID rfc5424 PROCID, rfc3164 PID of the tag
+	ProcID *string
+	// MsgID rfc5424
+	MsgID *string
+	// StructuredData rfc5424, nil for NILVALUE
+	StructuredData StructuredData
+	// Tag rfc3164, the program name of the tag, without the PID
+	Tag string
+	// Message rfc5424 MSG, rfc3164 CONTENT
+	Message string
+	// UTF8 rfc5424, MSG started with the BOM and is declared UTF-8, the BOM is
+	// not part of Message
+	UTF8 bool
+
+	// Cisco the fields of the Cisco IOS, NX-OS and ASA messages
+	Cisco CiscoMessage
+	// CEF the event carried by Message when it starts with "CEF:", nil
+	// otherwise, see ParsePayload
+	CEF *CEF
+	// LEEF the event carried by Message when it starts with "LEEF:", nil
+	// otherwise, see ParsePayload
+	LEEF *LEEF
+
+	// Client the address the log was received from
+	Client string
+}
+
+// CiscoMessage is the Cisco specific part of a message, e.g.
+// "123: *Mar  1 18:46:11.123 UTC: %LINK-3-UPDOWN: Interface ...", zero for any
+// other message
+type CiscoMessage struct {
+	// Sequence the sequence number, 0 when the messages are not numbered
+	Sequence int
+	// Facility of %FACILITY-SEVERITY-MNEMONIC, e.g. LINK or ASA
+	Facility string
+	// Severity of %FACILITY-SEVERITY-MNEMONIC, a syslog severity
+	Severity int
+	// Mnemonic of %FACILITY-SEVERITY-MNEMONIC, e.g. UPDOWN, the message ID of
+	// the ASA messages, e.g. 302013
+	Mnemonic string
+}
+
+// nilOr returns nil for the NILVALUE and the empty string, a pointer to s otherwise
+func nilOr(s string) *string {
+	if s == "" || s == "-" {
+		return nil
+	}
+
+	return &s
+}
@@ -2,9 +2,9 @@ package parser
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
+	"unsafe"
 )
 
 const (
@@ -37,10 +37,43 @@ type Parser interface {
 	Location(*time.Location)
 }
 
+// LogParser is implemented by the parsers able to parse into a given Log,
+// e.g. one from AcquireLog. The Log is filled as by Parse, which returns the
+// same error.
+type LogParser interface {
+	ParseLog(log *Log, client string) error
+}
+
+// TimezoneResolver resolves the timezone of the timestamps without a zone, e.g.
+// per source, see Log.SetTimezoneResolver. It is used concurrently.
+type TimezoneResolver interface {
+	// Timezone returns the location of the timestamps of hostname received from
+	// client, nil when unknown
+	Timezone(client string, hostname []byte) *time.Location
+}
+
 type Error struct {
 	Msg string
 }
 
+// ParseError is an error found at Offset of the log while parsing Field,
+// errors.Is matches the sentinel Err, e.g. errors.Is(err, ErrPriorityNoEnd)
+type ParseError struct {
+	// Err the sentinel error
+	Err error
+	// Field the name of the failing field, as in the Header of the Log
+	Field string
+	// Offset of the failing byte in the log
+	Offset int
+	// Expected what was expected at Offset, in the words of the RFC ABNF
+	Expected string
+	// Actual the first bytes found at Offset, nil at the end of the log
+	Actual []byte
+}
+
+// maxActual bounds the bytes kept by ParseError.Actual
+const maxActual = 16
+
 type Priority struct {
 	P int
 	F Facility
@@ -55,7 +88,8 @@ type Severity struct {
 	Value int
 }
 
-// ParsePriority https://tools.ietf.org/html/rfc3164#section-4.1
+// ParsePriority https://tools.ietf.org/html/rfc3164#section-4.1, on error the
+// cursor is left on the failing byte, see NewPriorityError
 func ParsePriority(buff []byte, cursor *int, l int) (Priority, error) {
 	pri := newPriority(0)
 
@@ -72,6 +106,7 @@ func ParsePriority(buff []byte, cursor *int, l int) (Priority, error) {
 
 	for i < l {
 		if i >= 5 {
+			*cursor = i
 			return pri, ErrPriorityTooLong
 		}
 
@@ -79,6 +114,7 @@ func ParsePriority(buff []byte, cursor *int, l int) (Priority, error) {
 
 		if c == PriPartEnd {
 			if i == 1 {
+				*cursor = i
 				return pri, ErrPriorityTooShort
 			}
 
@@ -87,19 +123,16 @@ func ParsePriority(buff []byte, cursor *int, l int) (Priority, error) {
 		}
 
 		if IsDigit(c) {
-			v, e := strconv.Atoi(string(c))
-			if e != nil {
-				return pri, e
-			}
-
-			priDigit = (priDigit * 10) + v
+			priDigit = (priDigit * 10) + int(c-'0')
 		} else {
+			*cursor = i
 			return pri, ErrPriorityNonDigit
 		}
 
 		i++
 	}
 
+	*cursor = i
 	return pri, ErrPriorityNoEnd
 }
 
@@ -117,13 +150,7 @@ func ParseVersion(buff []byte, cursor *int, l int) (int, error) {
 		return NoVersion, nil
 	}
 
-	v, e := strconv.Atoi(string(c))
-	if e != nil {
-		*cursor--
-		return NoVersion, e
-	}
-
-	return v, nil
+	return int(c - '0'), nil
 }
 
 func IsDigit(c byte) bool {
@@ -161,27 +188,29 @@ func Parse2Digits(buff []byte, cursor *int, l int, min int, max int, e error) (i
 		return 0, ErrEOL
 	}
 
-	sub := string(buff[*cursor : *cursor+digitLen])
-
-	*cursor += digitLen
-
-	i, err := strconv.Atoi(sub)
-	if err != nil {
+	i, ok := ParseDigits(buff[*cursor : *cursor+digitLen])
+	if !ok || i < min || i > max {
+		// the cursor is left on the digits
 		return 0, e
 	}
 
-	if i >= min && i <= max {
-		return i, nil
-	}
+	*cursor += digitLen
 
-	return 0, e
+	return i, nil
 }
 
 func ParseHostname(buff []byte, cursor *int, l int) (string, error) {
+	hostname, err := ParseHostnameBytes(buff, cursor, l)
+
+	return string(hostname), err
+}
+
+// ParseHostnameBytes is ParseHostname returning a slice of buff
+func ParseHostnameBytes(buff []byte, cursor *int, l int) ([]byte, error) {
 	from := *cursor
 
 	if from >= l {
-		return "", ErrHostnameTooShort
+		return nil, ErrHostnameTooShort
 	}
 
 	var to int
@@ -192,11 +221,44 @@ func ParseHostname(buff []byte, cursor *int, l int) (string, error) {
 		}
 	}
 
-	hostname := buff[from:to]
-
 	*cursor = to
 
-	return string(hostname), nil
+	return buff[from:to], nil
+}
+
+// ParseDigits parses the unsigned decimal number b, without allocating
+func ParseDigits(b []byte) (int, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+
+	n := 0
+	for _, c := range b {
+		if !IsDigit(c) {
+			return 0, false
+		}
+
+		n = n*10 + int(c-'0')
+	}
+
+	return n, true
+}
+
+// ParseTime is time.ParseInLocation on a slice of the log, without copying
+// value when the layout has no zone name
+func ParseTime(layout string, value []byte, location *time.Location) (time.Time, error) {
+	if strings.Contains(layout, "MST") {
+		// the name of an unknown zone is kept by the location of the time
+		return time.ParseInLocation(layout, string(value), location)
+	}
+
+	ts, err := time.ParseInLocation(layout, unsafe.String(unsafe.SliceData(value), len(value)), location)
+	if err != nil {
+		// the error keeps value, which may be reused
+		return ts, ErrTimestampUnknownFormat
+	}
+
+	return ts, nil
 }
 
 func ShowCursorPos(buff []byte, cursor int) {
@@ -208,3 +270,49 @@ func ShowCursorPos(buff []byte, cursor int) {
 func (err *Error) Error() string {
 	return err.Msg
 }
+
+// NewParseError returns the error err found at offset of buff while parsing
+// field, Actual is a copy of the bytes found there
+func NewParseError(err error, field string, buff []byte, offset int, expected string) *ParseError {
+	var actual []byte
+	if offset >= 0 && offset < len(buff) {
+		actual = append(actual, buff[offset:min(offset+maxActual, len(buff))]...)
+	}
+
+	return &ParseError{
+		Err:      err,
+		Field:    field,
+		Offset:   offset,
+		Expected: expected,
+		Actual:   actual,
+	}
+}
+
+// NewPriorityError returns the *ParseError of err returned by ParsePriority,
+// cursor being where ParsePriority left it
+func NewPriorityError(err error, buff []byte, cursor int) *ParseError {
+	expected := "PRIVAL"
+	switch err {
+	case ErrPriorityEmpty, ErrPriorityNoStart:
+		expected = `"<"`
+	case ErrPriorityNonDigit:
+		expected = `DIGIT or ">"`
+	case ErrPriorityTooLong, ErrPriorityNoEnd:
+		expected = `">"`
+	}
+
+	return NewParseError(err, "priority", buff, cursor, expected)
+}
+
+func (err *ParseError) Error() string {
+	found := "end of log"
+	if err.Actual != nil {
+		found = fmt.Sprintf("%q", err.Actual)
+	}
+
+	return fmt.Sprintf("%s: %s at offset %d, expected %s, found %s", err.Field, err.Err.Error(), err.Offset, err.Expected, found)
+}
+
+func (err *ParseError) Unwrap() error {
+	return err.Err
+}
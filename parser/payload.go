@@ -0,0 +1,150 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+)
+
+var (
+	cefPrefix  = []byte("CEF:")
+	leefPrefix = []byte("LEEF:")
+)
+
+// Attribute a key=value of a CEF extension or of the LEEF attributes, the
+// value is unescaped
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Attributes the key=value pairs of an event in order
+type Attributes []Attribute
+
+// Get returns the value of the first attribute named key
+func (a Attributes) Get(key string) (string, bool) {
+	for _, attribute := range a {
+		if attribute.Key == key {
+			return attribute.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// ParsePayload parses the event carried by payload, the RFC3164 CONTENT or the
+// RFC5424 MSG at offset of the log, once the header is parsed: a CEF event when
+// it starts with "CEF:", a LEEF event when it starts with "LEEF:". A malformed
+// event is added to the warnings, the payload being kept as is.
+func ParsePayload(log *Log, payload []byte, offset int) {
+	log.payload = offset
+
+	switch {
+	case bytes.HasPrefix(payload, cefPrefix):
+		cef, err := ParseCEF(payload)
+		if err != nil {
+			err.Offset += offset
+			log.AddWarning(err)
+			return
+		}
+
+		log.SetCEF(cef)
+	case bytes.HasPrefix(payload, leefPrefix):
+		leef, err := ParseLEEF(payload)
+		if err != nil {
+			err.Offset += offset
+			log.AddWarning(err)
+			return
+		}
+
+		log.SetLEEF(leef)
+	}
+}
+
+// ReparsePayload parses the event of payload, the content or the message of log
+// once transcoded to UTF-8, in place of the one parsed from the raw bytes by
+// ParsePayload: a multibyte character of GBK or Big5 may have a pipe or a
+// backslash as second byte. The offset of a warning counts the bytes of the
+// transcoded payload.
+func ReparsePayload(log *Log, payload []byte) {
+	log.Syslog.CEF = nil
+	log.Syslog.LEEF = nil
+
+	warnings := log.Warnings[:0]
+	for _, warning := range log.Warnings {
+		if warning.Field != "cef" && warning.Field != "leef" {
+			warnings = append(warnings, warning)
+		}
+	}
+
+	log.Warnings = warnings
+	if len(warnings) == 0 {
+		log.Warnings = nil
+	}
+
+	ParsePayload(log, payload, log.payload)
+}
+
+// parseHeaderFields parses the fields of a header separated by pipes, from the
+// pipe at cursor, a pipe being escaped by a backslash. It returns the cursor
+// after the pipe ending the last field, err of field when a field is missing.
+func parseHeaderFields(b []byte, cursor int, field string, err *Error, fields ...*string) (int, *ParseError) {
+	for _, f := range fields {
+		if cursor >= len(b) {
+			return cursor, NewParseError(err, field, b, cursor, `"|"`)
+		}
+
+		to := indexUnescaped(b, cursor+1, '|')
+		*f = unescape(b[cursor+1:to], "|\\")
+		cursor = to
+	}
+
+	if cursor >= len(b) {
+		return cursor, NewParseError(err, field, b, cursor, `"|"`)
+	}
+
+	return cursor + 1, nil
+}
+
+// indexUnescaped returns the index of the first c of b from from that is not
+// escaped by a backslash, len(b) if none
+func indexUnescaped(b []byte, from int, c byte) int {
+	for i := from; i < len(b); i++ {
+		if b[i] == '\\' {
+			i++
+			continue
+		}
+
+		if b[i] == c {
+			return i
+		}
+	}
+
+	return len(b)
+}
+
+// unescape removes the backslash before the chars of escaped in b, \n and \r
+// being newlines when escaped has n and r. Any other backslash is kept.
+func unescape(b []byte, escaped string) string {
+	if bytes.IndexByte(b, '\\') < 0 {
+		return string(b)
+	}
+
+	var s strings.Builder
+	s.Grow(len(b))
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if c == '\\' && i+1 < len(b) && strings.IndexByte(escaped, b[i+1]) >= 0 {
+			i++
+			switch c = b[i]; c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			}
+		}
+
+		s.WriteByte(c)
+	}
+
+	return s.String()
+}
@@ -0,0 +1,134 @@
+package parser
+
+import "sync"
+
+var logPool = sync.Pool{
+	New: func() any {
+		return &Log{
+			Header: make(map[string]interface{}),
+			Syslog: SyslogMessage{Version: NoVersion},
+		}
+	},
+}
+
+// AcquireLog returns a Log of body from the pool, to be parsed by a LogParser.
+// Its string fields are kept as slices of body until a string is asked for:
+// Get, GetString, Set and Materialize fill the Header and the string fields of
+// Syslog, while GetBytes and StructuredData read the slices directly. Until
+// then the string fields of Syslog (Hostname, AppName, Tag, Message...) are
+// empty.
+//
+// The Log, body and every slice of it may only be used until ReleaseLog, use
+// Clone to keep the log longer.
+func AcquireLog(body []byte) *Log {
+	l := logPool.Get().(*Log)
+	l.Body = body
+	l.len = len(body)
+	l.pooled = true
+
+	return l
+}
+
+// ReleaseLog puts l back to the pool, l must not be used anymore
+func ReleaseLog(l *Log) {
+	header := l.Header
+	clear(header)
+
+	*l = Log{
+		Header: header,
+		Syslog: SyslogMessage{Version: NoVersion},
+	}
+
+	logPool.Put(l)
+}
+
+// Materialize converts the fields of a pooled Log to strings, filling the
+// Header and Syslog, it does nothing on any other Log
+func (l *Log) Materialize() {
+	if !l.pooled {
+		return
+	}
+
+	l.pooled = false
+	for k := key(0); k < keys; k++ {
+		if l.set&(1<<k) != 0 {
+			l.materialize(k)
+		}
+	}
+}
+
+func (l *Log) materialize(k key) {
+	switch k {
+	case keyPriority:
+		l.SetPriority(l.Syslog.Priority)
+	case keyFacility:
+		l.SetFacility(l.Syslog.Facility)
+	case keySeverity:
+		l.SetSeverity(l.Syslog.Severity)
+	case keyVersion:
+		l.SetVersion(l.Syslog.Version)
+	case keyTimestamp:
+		l.SetTimestamp(l.timestamp)
+	case keyClient:
+		l.SetClient(l.Syslog.Client)
+	case keySequence:
+		l.SetSequence(l.Syslog.Cisco.Sequence)
+	case keyCiscoSeverity:
+		l.SetCiscoSeverity(l.Syslog.Cisco.Severity)
+	case keyHostname:
+		l.SetHostname(string(l.raw[k]))
+	case keyAppName:
+		l.SetAppName(string(l.raw[k]))
+	case keyProcId:
+		l.SetProcId(string(l.raw[k]))
+	case keyMsgId:
+		l.SetMsgId(string(l.raw[k]))
+	case keyTag:
+		l.SetTag(string(l.raw[k]))
+	case keyContent:
+		l.SetContent(string(l.raw[k]))
+	case keyMessage:
+		l.SetMessage(string(l.raw[k]))
+	case keyCiscoFacility:
+		l.SetCiscoFacility(string(l.raw[k]))
+	case keyMnemonic:
+		l.SetMnemonic(string(l.raw[k]))
+	case keyStructuredData:
+		if l.sdParsed {
+			l.SetStructuredData(string(l.raw[k]))
+		} else {
+			l.SetStructuredDataBytes(l.raw[k])
+		}
+	}
+}
+
+// Clone returns a copy of l that is not pooled and owns its Body, for a
+// handler keeping the log after Handle returned
+func (l *Log) Clone() *Log {
+	l.Materialize()
+
+	body := make([]byte, len(l.Body))
+	copy(body, l.Body)
+
+	c := NewLogWith(make(map[string]interface{}, len(l.Header)), body)
+	for k, v := range l.Header {
+		c.Header[k] = v
+	}
+
+	c.Syslog = l.Syslog
+	c.Envelope = l.Envelope
+	c.timestamp = l.timestamp
+	if l.Syslog.Timestamp != nil {
+		c.Syslog.Timestamp = &c.timestamp
+	}
+
+	c.Err = l.Err
+	c.Warnings = l.Warnings
+	c.cursor = l.cursor
+	c.len = l.len
+	c.skipTag = l.skipTag
+	c.sdParsed = l.sdParsed
+	c.payload = l.payload
+
+	return c
+}
@@ -0,0 +1,308 @@
+package rfc3164
+
+import (
+	"github.com/crazy-airhead/gsyslog/parser"
+	"strings"
+	"time"
+)
+
+// Layout is a timestamp format of the RFC3164 logs, see Parser.SetLayouts
+type Layout interface {
+	// Parse parses the timestamp at the start of b, in loc unless it has a
+	// zone, and returns its length
+	Parse(b []byte, loc *time.Location) (time.Time, int, error)
+	// Numeric tells whether the timestamps start with a digit, those layouts
+	// are tried first for the logs starting with a digit
+	Numeric() bool
+}
+
+// TimeLayout is a layout of the time package, e.g. time.Stamp. The timestamp
+// spans as many words as the layout, any number of spaces separating them, so
+// "Jan _2" matches "Oct  1" as well as "Oct 1". A zone name ("MST") only
+// matches UTC, GMT, Z, a numeric offset or a name of the zone of the parser
+// location, the zone-less layouts being tried next.
+type TimeLayout string
+
+var (
+	// Epoch the seconds since 1970-01-01 UTC, with an optional fraction, e.g.
+	// 1065910455 or 1065910455.003
+	Epoch Layout = epochLayout{}
+
+	// Cisco the timestamps of Cisco IOS, e.g. "*Mar  1 18:46:11.123 UTC:", the
+	// leading '*' or '.' telling the clock is not synchronized and the zone
+	// being optional. Any zone name is accepted before the colon, the unknown
+	// ones being in the parser location.
+	Cisco Layout = ciscoLayout{}
+
+	// DefaultLayouts the layouts tried when none is set, in order
+	DefaultLayouts = []Layout{
+		TimeLayout("Jan _2 15:04:05 MST"),  // Oct 11 22:14:15 UTC
+		TimeLayout(time.Stamp),             // Oct 11 22:14:15, Oct 11 22:14:15.000
+		TimeLayout("Jan _2 2006 15:04:05"), // Oct 11 2003 22:14:15
+		Cisco,                              // *Oct 11 22:14:15.003 UTC:
+		TimeLayout(time.DateTime),          // 2003-10-11 22:14:15
+		TimeLayout(time.RFC3339),           // 2003-10-11T22:14:15.003+08:00
+		Epoch,                              // 1065910455
+	}
+)
+
+func (l TimeLayout) Parse(b []byte, loc *time.Location) (time.Time, int, error) {
+	return l.parse(b, false, loc)
+}
+
+func (l TimeLayout) Numeric() bool {
+	return len(l) > 0 && parser.IsDigit(l[0])
+}
+
+// parse parses the timestamp at the start of b, see match
+func (l TimeLayout) parse(b []byte, trimColon bool, loc *time.Location) (time.Time, int, error) {
+	n, z, ok := l.match(b, trimColon, loc)
+	if !ok {
+		return time.Time{}, 0, parser.ErrTimestampUnknownFormat
+	}
+
+	if z.loc == nil {
+		ts, err := parser.ParseTime(string(l), b[:n], loc)
+		if err != nil {
+			return ts, 0, parser.ErrTimestampUnknownFormat
+		}
+
+		return ts, n, nil
+	}
+
+	// the zone is resolved by match, the timestamp is parsed without it
+	layout := strings.Join(strings.Fields(strings.Replace(string(l), "MST", "", 1)), " ")
+	value := strings.TrimLeft(string(b[:z.prev])+string(b[z.to:n]), " ")
+	ts, err := time.ParseInLocation(layout, value, z.loc)
+	if err != nil {
+		return ts, 0, parser.ErrTimestampUnknownFormat
+	}
+
+	return ts, n, nil
+}
+
+// zone the zone word of a timestamp, from prev, the end of the word before it,
+// to to, and its location
+type zone struct {
+	prev int
+	to   int
+	loc  *time.Location
+}
+
+// match returns the length of the words of b matching the words of the layout,
+// a digit matching a digit and a letter a letter, so that most timestamps of
+// other layouts are rejected before being parsed. The colon ending the last
+// word is left out when trimColon is set. A zone name ("MST") only matches a
+// zone, see zoneLocation, so that an upper case hostname is not taken for one.
+// When the colon ends the timestamp, any upper case word is a zone, in loc.
+func (l TimeLayout) match(b []byte, trimColon bool, loc *time.Location) (int, zone, bool) {
+	layout := string(l)
+	end := 0
+	var z zone
+
+	for layout != "" {
+		var word string
+		if i := strings.IndexByte(layout, ' '); i >= 0 {
+			word, layout = layout[:i], layout[i+1:]
+		} else {
+			word, layout = layout, ""
+		}
+
+		if word == "" {
+			continue
+		}
+
+		from := end
+		for from < len(b) && b[from] == ' ' {
+			from++
+		}
+
+		if end > 0 && from == end {
+			// no space between two words
+			return 0, z, false
+		}
+
+		to := from
+		for to < len(b) && b[to] != ' ' {
+			to++
+		}
+
+		if trimColon && layout == "" && to > from && b[to-1] == ':' {
+			to--
+		}
+
+		if to == from {
+			return 0, z, false
+		}
+
+		if word == "MST" {
+			z = zone{prev: end, to: to, loc: zoneLocation(b[from:to], loc)}
+			if z.loc == nil && trimColon && isZoneName(b[from:to]) {
+				z.loc = loc
+			}
+
+			if z.loc == nil {
+				return 0, z, false
+			}
+		} else if !matchWord(word, b[from:to]) {
+			return 0, z, false
+		}
+
+		end = to
+	}
+
+	return end, z, true
+}
+
+// matchWord tells whether value may be a word of layout
+func matchWord(word string, value []byte) bool {
+	layoutDigit := parser.IsDigit(word[0]) || word[0] == '_'
+	return layoutDigit == parser.IsDigit(value[0])
+}
+
+// zoneLocation returns the location of value, nil when it is not a zone: UTC,
+// GMT, Z, a numeric offset, e.g. +08, +0800 or +08:00, or a name of the zone of
+// loc, e.g. CST in Asia/Shanghai or CET and CEST in Europe/Paris
+func zoneLocation(value []byte, loc *time.Location) *time.Location {
+	switch string(value) {
+	case "UTC", "GMT", "Z":
+		return time.UTC
+	}
+
+	if value[0] == '+' || value[0] == '-' {
+		return offsetLocation(value)
+	}
+
+	if !isZoneName(value) {
+		return nil
+	}
+
+	// the names of loc in winter and in summer
+	year := time.Now().Year()
+	for _, month := range []time.Month{time.January, time.July} {
+		if name, _ := time.Date(year, month, 1, 0, 0, 0, 0, loc).Zone(); name == string(value) {
+			return loc
+		}
+	}
+
+	return nil
+}
+
+// offsetLocation returns the fixed zone of the offset value, +hh, +hhmm or
+// +hh:mm, nil when it is not an offset
+func offsetLocation(value []byte) *time.Location {
+	digits := make([]byte, 0, 4)
+	for i, c := range value[1:] {
+		if c == ':' && i == 2 && len(value) == 6 {
+			continue
+		}
+
+		if !parser.IsDigit(c) {
+			return nil
+		}
+
+		digits = append(digits, c)
+	}
+
+	if len(digits) != 2 && len(digits) != 4 {
+		return nil
+	}
+
+	hours, _ := parser.ParseDigits(digits[:2])
+	minutes := 0
+	if len(digits) == 4 {
+		minutes, _ = parser.ParseDigits(digits[2:])
+	}
+
+	if hours > 14 || minutes > 59 {
+		return nil
+	}
+
+	offset := hours*60*60 + minutes*60
+	if value[0] == '-' {
+		offset = -offset
+	}
+
+	return time.FixedZone(string(value), offset)
+}
+
+// isZoneName tells whether value may be the name of a zone, 3 to 5 upper case
+// letters
+func isZoneName(value []byte) bool {
+	for _, c := range value {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+
+	return len(value) >= 3 && len(value) <= 5
+}
+
+type epochLayout struct{}
+
+func (epochLayout) Parse(b []byte, loc *time.Location) (time.Time, int, error) {
+	end := 0
+	for end < len(b) && parser.IsDigit(b[end]) {
+		end++
+	}
+
+	// from 2001-09-09 on
+	sec, ok := parser.ParseDigits(b[:end])
+	if !ok || end < 10 || end > 11 {
+		return time.Time{}, 0, parser.ErrTimestampUnknownFormat
+	}
+
+	nsec := 0
+	if end < len(b) && b[end] == '.' {
+		from := end + 1
+		end = from
+		for end < len(b) && end-from < 9 && parser.IsDigit(b[end]) {
+			nsec = nsec*10 + int(b[end]-'0')
+			end++
+		}
+
+		for digits := end - from; digits < 9; digits++ {
+			nsec *= 10
+		}
+	}
+
+	if end < len(b) && b[end] != ' ' {
+		return time.Time{}, 0, parser.ErrTimestampUnknownFormat
+	}
+
+	return time.Unix(int64(sec), int64(nsec)).In(loc), end, nil
+}
+
+func (epochLayout) Numeric() bool {
+	return true
+}
+
+type ciscoLayout struct{}
+
+var ciscoLayouts = []TimeLayout{
+	"Jan _2 15:04:05 MST",
+	time.Stamp,
+}
+
+func (ciscoLayout) Parse(b []byte, loc *time.Location) (time.Time, int, error) {
+	from := 0
+	if len(b) > 0 && (b[0] == '*' || b[0] == '.') {
+		from = 1
+	}
+
+	for _, layout := range ciscoLayouts {
+		ts, n, err := layout.parse(b[from:], true, loc)
+		if err != nil || from+n >= len(b) || b[from+n] != ':' {
+			continue
+		}
+
+		// the colon ends the timestamp
+		return ts, from + n + 1, nil
+	}
+
+	return time.Time{}, 0, parser.ErrTimestampUnknownFormat
+}
+
+func (ciscoLayout) Numeric() bool {
+	return false
+}
@@ -9,8 +9,19 @@ import (
 	"time"
 )
 
+// MaxTagLen is the longest TAG allowed by RFC3164 s4.1.3, see SetMaxTagLen
+const MaxTagLen = 32
+
 type Parser struct {
 	location *time.Location
+	// maxTagLen the longest tag, not limited when 0
+	maxTagLen int
+	// layouts the timestamp layouts, DefaultLayouts when nil
+	layouts []Layout
+	// clock the reference time of the year inference, time.Now when nil
+	clock func() time.Time
+	// skew how far in the future a timestamp may be, not limited when 0
+	skew time.Duration
 }
 
 func NewParser() *Parser {
@@ -23,26 +34,74 @@ func (p *Parser) Location(location *time.Location) {
 	p.location = location
 }
 
+// SetMaxTagLen Sets the longest program name of a tag, e.g. MaxTagLen. A longer
+// one is not a tag but part of the content. It is not limited by default.
+func (p *Parser) SetMaxTagLen(n int) {
+	p.maxTagLen = n
+}
+
+// SetLayouts Sets the timestamp layouts tried in order, DefaultLayouts by
+// default, e.g. SetLayouts(append(rfc3164.DefaultLayouts, rfc3164.TimeLayout(time.ANSIC))...)
+func (p *Parser) SetLayouts(layouts ...Layout) {
+	p.layouts = layouts
+}
+
+// SetClock Sets the clock giving the reference time of a log, its receive time
+// by default, see parser.Envelope. The year of a timestamp without one is the
+// year putting it the closest to the reference time, see InferYear. Replaying
+// old logs, the clock may return the time they were written at.
+func (p *Parser) SetClock(clock func() time.Time) {
+	p.clock = clock
+}
+
+// SetYearSkew Sets how far after the reference time a timestamp without a year
+// may be, the clock of a sender being ahead by skew at most, see InferYear. It
+// is not limited by default.
+func (p *Parser) SetYearSkew(skew time.Duration) {
+	p.skew = skew
+}
+
+// now returns the reference time of log, its receive time by default, the
+// current time when it is not known
+func (p *Parser) now(log *parser.Log) time.Time {
+	if p.clock != nil {
+		return p.clock()
+	}
+
+	if received := log.Envelope.ReceivedAt; !received.IsZero() {
+		return received
+	}
+
+	return time.Now()
+}
+
 func (p *Parser) Parse(data []byte, client string) (*parser.Log, error) {
 	log := parser.NewLog(data)
+	err := p.ParseLog(log, client)
+
+	return log, err
+}
+
+// ParseLog parses log.Body into log, see parser.LogParser
+func (p *Parser) ParseLog(log *parser.Log, client string) error {
 	log.SetClient(client)
 
 	err := parsePriority(log)
 	if err != nil {
-		log.SetTimestamp(time.Now().Round(time.Second))
+		log.SetTimestamp(p.now(log).Round(time.Second))
 		log.SetHostname("")
 
 		log.SetTag("")
 		err = parseContent(log)
 		log.Err = err
-		return log, err
+		return err
 	}
 
 	tCursor := log.Cursor()
 	err = p.parseHeader(log)
 	if errors.Is(err, parser.ErrTimestampUnknownFormat) {
 		// RFC3164 sec 4.3.2.
-		log.SetTimestamp(time.Now().Round(time.Second))
+		log.SetTimestamp(p.now(log).Round(time.Second))
 		log.SetHostname("")
 
 		// No tag processing should be done
@@ -51,18 +110,18 @@ func (p *Parser) Parse(data []byte, client string) (*parser.Log, error) {
 		log.SetCursor(tCursor)
 	} else if err != nil {
 		log.Err = err
-		return log, nil
+		return nil
 	} else {
 		log.MoveCursor()
 	}
 
-	err = parseMessage(log)
+	err = p.parseMessage(log)
 	if !errors.Is(err, parser.ErrEOL) {
 		log.Err = err
-		return log, err
+		return err
 	}
 
-	return log, nil
+	return nil
 }
 
 // parsePriority 识别成功时移动光标，未成功时不移动
@@ -75,7 +134,7 @@ func parsePriority(log *parser.Log) error {
 		log.SetFacility(1)
 		log.SetSeverity(5)
 
-		return err
+		return parser.NewPriorityError(err, log.Body, cursor)
 	}
 
 	log.SetPriority(priority.P)
@@ -89,7 +148,8 @@ func parsePriority(log *parser.Log) error {
 }
 
 func (p *Parser) parseHeader(log *parser.Log) error {
-	err := parseTimestamp(log, p.location)
+	tCursor := log.Cursor()
+	err := p.parseTimestamp(log, p.location)
 	if err != nil {
 		return err
 	}
@@ -99,43 +159,65 @@ func (p *Parser) parseHeader(log *parser.Log) error {
 		return err
 	}
 
+	p.resolveTimezone(log, tCursor)
+
 	return nil
 }
 
-// https://tools.ietf.org/html/rfc3164#section-4.1.2
-func parseTimestamp(log *parser.Log, location *time.Location) error {
-	var ts time.Time
-	var err error
-	var tsFmtLen int
-	var sub []byte
+// resolveTimezone parses the timestamp at tCursor again in the timezone of the
+// source of log, if any, now that its hostname is known. The timestamps with a
+// zone are kept as is.
+func (p *Parser) resolveTimezone(log *parser.Log, tCursor int) {
+	r := log.TimezoneResolver()
+	if r == nil {
+		return
+	}
 
-	tsFmts := []string{
-		time.Stamp,
-		time.RFC3339,
+	location := r.Timezone(log.Syslog.Client, log.GetBytes("hostname"))
+	if location == nil || location == p.location {
+		return
 	}
-	// if timestamps starts with numeric try formats with different order
-	// it is more likely that timestamp is in RFC3339 format then
+
 	cursor := log.Cursor()
-	if c := log.Body[cursor]; c > '0' && c < '9' {
-		tsFmts = []string{
-			time.RFC3339,
-			time.Stamp,
-		}
+	log.SetCursor(tCursor)
+	_ = p.parseTimestamp(log, location)
+	log.SetCursor(cursor)
+}
+
+// https://tools.ietf.org/html/rfc3164#section-4.1.2
+// The layouts are tried in order, the numeric ones first when the timestamp
+// starts with a digit, as it is more likely in RFC3339 format then.
+func (p *Parser) parseTimestamp(log *parser.Log, location *time.Location) error {
+	layouts := p.layouts
+	if layouts == nil {
+		layouts = DefaultLayouts
 	}
 
-	found := false
-	for _, tsFmt := range tsFmts {
-		tsFmtLen = len(tsFmt)
+	cursor := log.Cursor()
+	b := log.Body[cursor:log.Len()]
+	numeric := len(b) > 0 && parser.IsDigit(b[0])
+	passes := 1
+	if numeric {
+		passes = 2
+	}
 
-		if cursor+tsFmtLen > log.Len() {
-			continue
-		}
+	var ts time.Time
+	var n int
+	var err error
 
-		sub = log.Body[cursor : tsFmtLen+cursor]
-		ts, err = time.ParseInLocation(tsFmt, string(sub), location)
-		if err == nil {
-			found = true
-			break
+	found := false
+	for pass := 0; pass < passes && !found; pass++ {
+		for _, layout := range layouts {
+			// the numeric layouts on the first pass, the others on the second
+			if numeric && layout.Numeric() != (pass == 0) {
+				continue
+			}
+
+			ts, n, err = layout.Parse(b, location)
+			if err == nil {
+				found = true
+				break
+			}
 		}
 	}
 
@@ -153,9 +235,11 @@ func parseTimestamp(log *parser.Log, location *time.Location) error {
 		return parser.ErrTimestampUnknownFormat
 	}
 
-	fixTimestampIfNeeded(&ts)
+	if ts.Year() == 0 {
+		ts = InferYear(ts, p.now(log), p.skew)
+	}
 
-	cursor += tsFmtLen
+	cursor += n
 
 	if (cursor < log.Len()) && (log.Body[cursor] == ' ') {
 		cursor++
@@ -168,29 +252,34 @@ func parseTimestamp(log *parser.Log, location *time.Location) error {
 
 func parseHostname(log *parser.Log) error {
 	cursor := log.Cursor()
-	hostname, err := parser.ParseHostname(log.Body, &cursor, log.Len())
-	if err == nil && len(hostname) > 0 && string(hostname[len(hostname)-1]) == ":" { // not an hostname! we found a GNU implementation of syslog()
+	hostname, err := parser.ParseHostnameBytes(log.Body, &cursor, log.Len())
+	if err == nil && len(hostname) > 0 && hostname[len(hostname)-1] == ':' { // not an hostname! we found a GNU implementation of syslog()
 		log.MoveCursorN(-1)
-		hostname, err = os.Hostname()
+		localHostname, err := os.Hostname()
 		if err == nil {
-			log.SetHostname(hostname)
+			log.SetHostname(localHostname)
 			return nil
 		}
 
 		log.SetHostname("")
-		fixHostname(log)
+		fixHostname(log, nil)
 		return nil
 	}
 
-	log.SetHostname(hostname)
-	fixHostname(log)
+	log.SetHostnameBytes(hostname)
+	fixHostname(log, hostname)
 	log.SetCursor(cursor)
-	return err
+
+	if err != nil {
+		return parser.NewParseError(err, "hostname", log.Body, cursor, "HOSTNAME")
+	}
+
+	return nil
 }
 
-func parseMessage(log *parser.Log) error {
+func (p *Parser) parseMessage(log *parser.Log) error {
 	if !log.SkipTag() {
-		err := parseTag(log)
+		err := p.parseTag(log)
 		if err != nil {
 			return err
 		}
@@ -207,53 +296,60 @@ func parseMessage(log *parser.Log) error {
 }
 
 // http://tools.ietf.org/html/rfc3164#section-4.1.3
-func parseTag(log *parser.Log) error {
-	var b byte
-	var endOfTag bool
-	var bracketOpen bool
-	var tag []byte
-	var err error
-	var found bool
-
+// The tag is the first word of the message when it ends with ':', e.g. "su:",
+// "postfix/smtpd[99]:" or "sshd[1234]:". The program name is the tag, the PID
+// between the brackets is the procId. Any other first word is content.
+func (p *Parser) parseTag(log *parser.Log) error {
 	from := log.Cursor()
-	cursor := log.Cursor()
-	for {
-		if cursor == log.Len() {
-			log.SetTag("")
-			return nil
-		}
+	to := from
+	for to < log.Len() && log.Body[to] != ' ' {
+		to++
+	}
 
-		b = log.Body[cursor]
-		bracketOpen = b == '['
-		endOfTag = b == ':' || b == ' '
+	word := log.Body[from:to]
+	program, pid, ok := splitTag(word)
+	if !ok || (p.maxTagLen > 0 && len(program) > p.maxTagLen) {
+		log.SetTag("")
+		return nil
+	}
 
-		// XXX : parse PID ?
-		if bracketOpen {
-			tag = log.Body[from:cursor]
-			found = true
-		}
+	cursor := to
+	if (cursor < log.Len()) && (log.Body[cursor] == ' ') {
+		cursor++
+	}
 
-		if endOfTag {
-			if !found {
-				tag = log.Body[from:cursor]
-				found = true
-			}
+	log.SetTagBytes(program)
+	if pid != nil {
+		log.SetProcIdBytes(pid)
+	}
 
-			cursor++
-			break
-		}
+	log.SetCursor(cursor)
 
-		cursor++
+	return nil
+}
+
+// splitTag splits word, "program:" or "program[pid]:", the colon being
+// optional after the PID. ok is false when word is not a tag.
+func splitTag(word []byte) (program []byte, pid []byte, ok bool) {
+	colon := len(word) > 1 && word[len(word)-1] == ':'
+	if colon {
+		word = word[:len(word)-1]
 	}
 
-	if (cursor < log.Len()) && (log.Body[cursor] == ' ') {
-		cursor++
+	if open := bytes.IndexByte(word, '['); open > 0 && word[len(word)-1] == ']' {
+		program = word[:open]
+		if pid = word[open+1 : len(word)-1]; len(pid) == 0 {
+			pid = nil
+		}
+
+		return program, pid, true
 	}
 
-	log.SetTag(string(tag))
-	log.SetCursor(cursor)
+	if !colon {
+		return nil, nil, false
+	}
 
-	return err
+	return word, nil, true
 }
 
 func parseContent(log *parser.Log) error {
@@ -262,34 +358,59 @@ func parseContent(log *parser.Log) error {
 		return parser.ErrEOL
 	}
 
-	content := bytes.Trim(log.Body[log.Cursor():log.Len()], " ")
+	b := log.Body[log.Cursor():log.Len()]
+	offset := log.Cursor() + len(b) - len(bytes.TrimLeft(b, " "))
+	content := bytes.Trim(b, " ")
 	log.MoveCursorN(len(content))
 
-	log.SetContent(string(content))
+	log.SetContentBytes(content)
+	parser.ParsePayload(log, content, offset)
+
 	return nil
 }
 
-func fixTimestampIfNeeded(ts *time.Time) {
-	now := time.Now()
-	y := ts.Year()
+// InferYear returns ts, a timestamp without a year, in the year putting it the
+// closest to ref, e.g. "Dec 31 23:59:59" received on January 1st is from the
+// year before. When skew is positive, a year putting ts more than skew after
+// ref is left out.
+func InferYear(ts time.Time, ref time.Time, skew time.Duration) time.Time {
+	inferred := ts
+	closest := time.Duration(-1)
+
+	// Feb 29 is in one of the four years before
+	for y := ref.Year() - 4; y <= ref.Year()+1; y++ {
+		candidate := time.Date(y, ts.Month(), ts.Day(), ts.Hour(), ts.Minute(),
+			ts.Second(), ts.Nanosecond(), ts.Location())
+		if candidate.Day() != ts.Day() {
+			// Feb 29 of a common year
+			continue
+		}
 
-	if ts.Year() == 0 {
-		y = now.Year()
-	}
+		d := candidate.Sub(ref)
+		if skew > 0 && d > skew {
+			continue
+		}
+
+		if d < 0 {
+			d = -d
+		}
 
-	newTs := time.Date(y, ts.Month(), ts.Day(), ts.Hour(), ts.Minute(),
-		ts.Second(), ts.Nanosecond(), ts.Location())
+		// the earlier year on a tie
+		if closest < 0 || d < closest {
+			inferred = candidate
+			closest = d
+		}
+	}
 
-	*ts = newTs
+	return inferred
 }
 
-func fixHostname(log *parser.Log) {
-	hostname := log.GetString("hostname")
-	if hostname != "" {
+func fixHostname(log *parser.Log, hostname []byte) {
+	if len(hostname) != 0 {
 		return
 	}
 
-	client := log.GetString("client")
+	client := log.Syslog.Client
 	if i := strings.Index(client, ":"); i > 1 {
 		log.SetHostname(client[:i])
 	}
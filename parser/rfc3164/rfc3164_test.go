@@ -1,6 +1,8 @@
 package rfc3164
 
 import (
+	"github.com/crazy-airhead/gsyslog/parser"
+	"strings"
 	"testing"
 	"time"
 
@@ -37,7 +39,7 @@ func (s *Rfc3164TestSuite) TestParser_Valid(c *C) {
 	now := time.Now()
 	expected := map[string]interface{}{
 		"client":    "",
-		"timestamp": time.Date(now.Year(), time.October, 11, 22, 14, 15, 0, time.UTC),
+		"timestamp": InferYear(time.Date(0, time.October, 11, 22, 14, 15, 0, time.UTC), now, 0),
 		"hostname":  "mymachine",
 		"tag":       "very.large.syslog.message.tag",
 		"content":   "'su root' failed for lonvick on /dev/pts/8",
@@ -66,7 +68,7 @@ func (s *Rfc3164TestSuite) TestParser_ValidNoTag(c *C) {
 
 	expected := map[string]interface{}{
 		"client":    "",
-		"timestamp": time.Date(now.Year(), time.October, 11, 22, 14, 15, 0, time.UTC),
+		"timestamp": InferYear(time.Date(0, time.October, 11, 22, 14, 15, 0, time.UTC), now, 0),
 		"hostname":  "mymachine",
 		"tag":       "",
 		"content":   "singleword",
@@ -78,6 +80,29 @@ func (s *Rfc3164TestSuite) TestParser_ValidNoTag(c *C) {
 	c.Assert(obtained.Header, DeepEquals, expected)
 }
 
+func (s *Rfc3164TestSuite) TestParser_Syslog(c *C) {
+	buff := []byte("<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8")
+
+	obtained, err := NewParser().Parse(buff, "192.0.2.1:514")
+	c.Assert(err, IsNil)
+
+	hostname := "mymachine"
+	ts := InferYear(time.Date(0, time.October, 11, 22, 14, 15, 0, time.UTC), time.Now(), 0)
+	expected := parser.SyslogMessage{
+		Priority:  34,
+		Facility:  4,
+		Severity:  2,
+		Version:   parser.NoVersion,
+		Timestamp: &ts,
+		Hostname:  &hostname,
+		Tag:       "su",
+		Message:   "'su root' failed for lonvick on /dev/pts/8",
+		Client:    "192.0.2.1:514",
+	}
+
+	c.Assert(obtained.Syslog, DeepEquals, expected)
+}
+
 // RFC 3164 section 4.3.2
 func (s *Rfc3164TestSuite) TestParser_NoTimestamp(c *C) {
 	buff := []byte("<14>INFO     leaving (1) step postscripts")
@@ -402,6 +427,423 @@ func (s *Rfc3164TestSuite) TestParser_NoPriority(c *C) {
 //}
 //
 
+func (s *Rfc3164TestSuite) TestParser_Tag(c *C) {
+	header := "<34>Oct 11 22:14:15 mymachine "
+
+	fixtures := []struct {
+		message string
+		tag     string
+		pid     string
+		content string
+	}{
+		{"sshd[1234]: Accepted publickey", "sshd", "1234", "Accepted publickey"},
+		{"postfix/smtpd[99]: connect from unknown", "postfix/smtpd", "99", "connect from unknown"},
+		{"kernel: [    0.000000] Linux version", "kernel", "", "[    0.000000] Linux version"},
+		{"org.gnome.Shell.desktop[2046]: msg", "org.gnome.Shell.desktop", "2046", "msg"},
+		{"app[worker-1] msg", "app", "worker-1", "msg"},
+		{"cron[]: msg", "cron", "", "msg"},
+		{"su:", "su", "", ""},
+		{"a message without a tag", "", "", "a message without a tag"},
+		{"host:port is not a tag", "", "", "host:port is not a tag"},
+	}
+
+	for _, fixture := range fixtures {
+		obtained, err := NewParser().Parse([]byte(header+fixture.message), "")
+		c.Assert(err, IsNil)
+		c.Assert(obtained.GetString("tag"), Equals, fixture.tag, Commentf("message %s", fixture.message))
+		c.Assert(obtained.GetString("procId"), Equals, fixture.pid, Commentf("message %s", fixture.message))
+		c.Assert(obtained.GetString("content"), Equals, fixture.content, Commentf("message %s", fixture.message))
+
+		if fixture.pid == "" {
+			c.Assert(obtained.Syslog.ProcID, IsNil)
+		} else {
+			c.Assert(*obtained.Syslog.ProcID, Equals, fixture.pid)
+		}
+	}
+
+	// the tag limit is only enforced when set
+	long := header + strings.Repeat("a", MaxTagLen+1) + "[1]: msg"
+
+	obtained, err := NewParser().Parse([]byte(long), "")
+	c.Assert(err, IsNil)
+	c.Assert(obtained.GetString("tag"), Equals, strings.Repeat("a", MaxTagLen+1))
+
+	p := NewParser()
+	p.SetMaxTagLen(MaxTagLen)
+	obtained, err = p.Parse([]byte(long), "")
+	c.Assert(err, IsNil)
+	c.Assert(obtained.GetString("tag"), Equals, "")
+	c.Assert(obtained.GetString("content"), Equals, strings.Repeat("a", MaxTagLen+1)+"[1]: msg")
+}
+
+func (s *Rfc3164TestSuite) TestParser_Timestamp(c *C) {
+	// the year-less timestamps are the closest to the reference time
+	year := 2003
+	ref := time.Date(year, 6, 1, 0, 0, 0, 0, time.UTC)
+	cet := time.FixedZone("", 2*60*60)
+
+	fixtures := []struct {
+		timestamp string
+		expected  time.Time
+	}{
+		{"Oct 11 22:14:15", time.Date(year, 10, 11, 22, 14, 15, 0, time.UTC)},
+		{"Oct  1 22:14:15", time.Date(year, 10, 1, 22, 14, 15, 0, time.UTC)},
+		{"Oct 11 22:14:15.003", time.Date(year, 10, 11, 22, 14, 15, 3000000, time.UTC)},
+		{"Oct 11 2003 22:14:15", time.Date(2003, 10, 11, 22, 14, 15, 0, time.UTC)},
+		{"Oct 11 22:14:15 UTC", time.Date(year, 10, 11, 22, 14, 15, 0, time.UTC)},
+		{"Oct 11 22:14:15 GMT", time.Date(year, 10, 11, 22, 14, 15, 0, time.UTC)},
+		{"Oct 11 22:14:15 Z", time.Date(year, 10, 11, 22, 14, 15, 0, time.UTC)},
+		{"Oct 11 22:14:15 +02", time.Date(year, 10, 11, 22, 14, 15, 0, cet)},
+		{"Oct 11 22:14:15 +0200", time.Date(year, 10, 11, 22, 14, 15, 0, cet)},
+		{"Oct 11 22:14:15 +02:00", time.Date(year, 10, 11, 22, 14, 15, 0, cet)},
+		{"*Mar  1 18:46:11.123 UTC:", time.Date(year, 3, 1, 18, 46, 11, 123000000, time.UTC)},
+		{".Mar  1 18:46:11:", time.Date(year, 3, 1, 18, 46, 11, 0, time.UTC)},
+		{"2003-10-11 22:14:15", time.Date(2003, 10, 11, 22, 14, 15, 0, time.UTC)},
+		{"2003-10-11T22:14:15Z", time.Date(2003, 10, 11, 22, 14, 15, 0, time.UTC)},
+		{"2003-10-11T22:14:15.003+02:00", time.Date(2003, 10, 11, 22, 14, 15, 3000000, cet)},
+		{"1065910455", time.Date(2003, 10, 11, 22, 14, 15, 0, time.UTC)},
+		{"1065910455.5", time.Date(2003, 10, 11, 22, 14, 15, 500000000, time.UTC)},
+		// numeric timestamps starting with 0 or 9
+		{"0999-10-11T22:14:15Z", time.Date(999, 10, 11, 22, 14, 15, 0, time.UTC)},
+		{"9999-10-11 22:14:15", time.Date(9999, 10, 11, 22, 14, 15, 0, time.UTC)},
+	}
+
+	for _, fixture := range fixtures {
+		buff := []byte("<34>" + fixture.timestamp + " mymachine su: msg")
+		p := NewParser()
+		p.SetClock(func() time.Time { return ref })
+		obtained, err := p.Parse(buff, "")
+		c.Assert(err, IsNil)
+		c.Assert(obtained.Syslog.Timestamp.Equal(fixture.expected), Equals, true,
+			Commentf("timestamp %s, obtained %s", fixture.timestamp, obtained.Syslog.Timestamp))
+		c.Assert(obtained.GetString("hostname"), Equals, "mymachine", Commentf("timestamp %s", fixture.timestamp))
+		c.Assert(obtained.GetString("tag"), Equals, "su", Commentf("timestamp %s", fixture.timestamp))
+	}
+
+	// an upper case hostname is not a zone
+	for _, hostname := range []string{"HOST1", "DMZ", "HOST", "FWALL"} {
+		obtained, err := NewParser().Parse([]byte("<34>Oct 11 22:14:15 "+hostname+" sshd[12]: hello"), "")
+		c.Assert(err, IsNil)
+		c.Assert(obtained.Syslog.Timestamp.Location(), Equals, time.UTC, Commentf("hostname %s", hostname))
+		c.Assert(obtained.GetString("hostname"), Equals, hostname)
+		c.Assert(obtained.GetString("tag"), Equals, "sshd")
+		c.Assert(obtained.GetString("procId"), Equals, "12")
+		c.Assert(obtained.GetString("content"), Equals, "hello")
+	}
+
+	// the names of the zone of the parser location are zones
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	c.Assert(err, IsNil)
+
+	p := NewParser()
+	p.Location(shanghai)
+	p.SetClock(func() time.Time { return ref })
+	obtained, err := p.Parse([]byte("<34>Oct 11 22:14:15 CST mymachine su: msg"), "")
+	c.Assert(err, IsNil)
+	c.Assert(obtained.Syslog.Timestamp.Equal(time.Date(year, 10, 11, 22, 14, 15, 0, shanghai)), Equals, true)
+	c.Assert(obtained.GetString("hostname"), Equals, "mymachine")
+
+	obtained, err = NewParser().Parse([]byte("<34>Oct 11 22:14:15 CST mymachine su: msg"), "")
+	c.Assert(err, IsNil)
+	c.Assert(obtained.GetString("hostname"), Equals, "CST")
+
+	// only the layouts set are tried
+	p = NewParser()
+	p.SetLayouts(TimeLayout(time.ANSIC))
+	obtained, err = p.Parse([]byte("<34>Sat Oct 11 22:14:15 2003 mymachine su: msg"), "")
+	c.Assert(err, IsNil)
+	c.Assert(*obtained.Syslog.Timestamp, Equals, time.Date(2003, 10, 11, 22, 14, 15, 0, time.UTC))
+	c.Assert(obtained.GetString("hostname"), Equals, "mymachine")
+
+	obtained, err = p.Parse([]byte("<34>Oct 11 22:14:15 mymachine su: msg"), "")
+	c.Assert(err, IsNil)
+	c.Assert(obtained.GetString("hostname"), Equals, "")
+	c.Assert(obtained.GetString("content"), Equals, "Oct 11 22:14:15 mymachine su: msg")
+}
+
+func (s *Rfc3164TestSuite) TestParser_Year(c *C) {
+	newYear := time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC)
+
+	fixtures := []struct {
+		timestamp string
+		ref       time.Time
+		skew      time.Duration
+		expected  time.Time
+	}{
+		// received just after New Year
+		{"Dec 31 23:59:59", newYear, 0, time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC)},
+		{"Jan  1 00:00:10", newYear, 0, time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC)},
+		// sent just after New Year by a clock ahead
+		{"Jan  1 00:00:10", time.Date(2023, 12, 31, 23, 59, 50, 0, time.UTC), 0, time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC)},
+		{"Jan  1 00:00:10", time.Date(2023, 12, 31, 23, 59, 50, 0, time.UTC), 10 * time.Second, time.Date(2023, 1, 1, 0, 0, 10, 0, time.UTC)},
+		{"Jan  1 00:00:10", time.Date(2023, 12, 31, 23, 59, 50, 0, time.UTC), time.Minute, time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC)},
+		// replayed
+		{"Jul 14 12:00:00", time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC), 0, time.Date(2019, 7, 14, 12, 0, 0, 0, time.UTC)},
+		// Feb 29 is in a leap year
+		{"Feb 29 12:00:00", time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), 0, time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"Feb 29 12:00:00", time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), time.Hour, time.Date(2020, 2, 29, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for _, fixture := range fixtures {
+		p := NewParser()
+		p.SetClock(func() time.Time { return fixture.ref })
+		p.SetYearSkew(fixture.skew)
+
+		obtained, err := p.Parse([]byte("<34>"+fixture.timestamp+" mymachine su: msg"), "")
+		c.Assert(err, IsNil)
+		c.Assert(*obtained.Syslog.Timestamp, Equals, fixture.expected, Commentf("timestamp %s", fixture.timestamp))
+	}
+
+	// the fallback timestamp is the reference time too
+	p := NewParser()
+	p.SetClock(func() time.Time { return newYear })
+	obtained, err := p.Parse([]byte("<34>no timestamp"), "")
+	c.Assert(err, IsNil)
+	c.Assert(*obtained.Syslog.Timestamp, Equals, newYear)
+
+	// the year of a timestamp is kept
+	obtained, err = p.Parse([]byte("<34>Oct 11 2003 22:14:15 mymachine su: msg"), "")
+	c.Assert(err, IsNil)
+	c.Assert(obtained.Syslog.Timestamp.Year(), Equals, 2003)
+
+	// the reference time is the receive time of the log unless a clock is set
+	log := parser.NewLog([]byte("<34>Dec 31 23:59:59 mymachine su: msg"))
+	log.SetEnvelope(parser.Envelope{ReceivedAt: newYear})
+	c.Assert(NewParser().ParseLog(log, ""), IsNil)
+	c.Assert(*log.Syslog.Timestamp, Equals, time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC))
+
+	log = parser.NewLog([]byte("<34>Dec 31 23:59:59 mymachine su: msg"))
+	log.SetEnvelope(parser.Envelope{ReceivedAt: newYear})
+	p.SetClock(func() time.Time { return time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC) })
+	c.Assert(p.ParseLog(log, ""), IsNil)
+	c.Assert(*log.Syslog.Timestamp, Equals, time.Date(2019, 12, 31, 23, 59, 59, 0, time.UTC))
+
+	log = parser.NewLog([]byte("<34>no timestamp"))
+	log.SetEnvelope(parser.Envelope{ReceivedAt: newYear})
+	c.Assert(NewParser().ParseLog(log, ""), IsNil)
+	c.Assert(*log.Syslog.Timestamp, Equals, newYear)
+}
+
+type timezones map[string]*time.Location
+
+func (t timezones) Timezone(client string, hostname []byte) *time.Location {
+	return t[string(hostname)]
+}
+
+func (s *Rfc3164TestSuite) TestParser_Timezone(c *C) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	ref := time.Date(2003, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	fixtures := []struct {
+		body     string
+		expected time.Time
+	}{
+		{"<34>Oct 11 22:14:15 tokyo su: msg", time.Date(2003, 10, 11, 22, 14, 15, 0, tokyo)},
+		{"<34>Oct 11 22:14:15 paris su: msg", time.Date(2003, 10, 11, 22, 14, 15, 0, time.UTC)},
+		{"<34>2003-10-11T22:14:15Z tokyo su: msg", time.Date(2003, 10, 11, 22, 14, 15, 0, time.UTC)},
+		{"<34>1065910455 tokyo su: msg", time.Date(2003, 10, 11, 22, 14, 15, 0, time.UTC)},
+	}
+
+	for _, fixture := range fixtures {
+		p := NewParser()
+		p.SetClock(func() time.Time { return ref })
+
+		log := parser.NewLog([]byte(fixture.body))
+		log.SetTimezoneResolver(timezones{"tokyo": tokyo})
+		c.Assert(p.ParseLog(log, ""), IsNil)
+		c.Assert(log.Syslog.Timestamp.Equal(fixture.expected), Equals, true,
+			Commentf("log %s, obtained %s", fixture.body, log.Syslog.Timestamp))
+		c.Assert(log.GetString("tag"), Equals, "su")
+		c.Assert(log.GetString("content"), Equals, "msg")
+	}
+}
+
+func (s *Rfc3164TestSuite) TestParser_CEF(c *C) {
+	body := `<134>Oct 11 22:14:15 host1 CEF:0|Security|threatmanager|1.0|100|detected a \| in message|10|` +
+		`src=10.0.0.1 act=blocked a \= dst=2.1.2.2 msg=Detected a threat. No action needed. cs1Label=a=b`
+
+	log, err := NewParser().Parse([]byte(body), "")
+	c.Assert(err, IsNil)
+	c.Assert(log.Warnings, HasLen, 0)
+	c.Assert(log.GetString("tag"), Equals, "")
+	c.Assert(log.Syslog.CEF, DeepEquals, &parser.CEF{
+		Version:       0,
+		DeviceVendor:  "Security",
+		DeviceProduct: "threatmanager",
+		DeviceVersion: "1.0",
+		SignatureID:   "100",
+		Name:          "detected a | in message",
+		Severity:      "10",
+		Extension: parser.Attributes{
+			{Key: "src", Value: "10.0.0.1"},
+			{Key: "act", Value: "blocked a ="},
+			{Key: "dst", Value: "2.1.2.2"},
+			{Key: "msg", Value: "Detected a threat. No action needed."},
+			{Key: "cs1Label", Value: "a=b"},
+		},
+	})
+
+	// a CEF event after a tag
+	log, err = NewParser().Parse([]byte("<134>Oct 11 22:14:15 host1 agent[12]: CEF:1|V|P|2|sig|name|Low|"), "")
+	c.Assert(err, IsNil)
+	c.Assert(log.GetString("tag"), Equals, "agent")
+	c.Assert(log.Syslog.CEF, NotNil)
+	c.Assert(log.Syslog.CEF.Version, Equals, 1)
+	c.Assert(log.Syslog.CEF.Severity, Equals, "Low")
+	c.Assert(log.Syslog.CEF.Extension, HasLen, 0)
+
+	// a truncated header is a warning, the content is kept
+	log, err = NewParser().Parse([]byte("<134>Oct 11 22:14:15 host1 CEF:0|Security|threatmanager"), "")
+	c.Assert(err, IsNil)
+	c.Assert(log.Syslog.CEF, IsNil)
+	c.Assert(log.GetString("content"), Equals, "CEF:0|Security|threatmanager")
+	c.Assert(log.Warnings, HasLen, 1)
+	c.Assert(log.Warnings[0].Err, Equals, parser.ErrCEFHeader)
+	c.Assert(log.Warnings[0].Field, Equals, "cef")
+	c.Assert(log.Warnings[0].Offset, Equals, 55)
+
+	log, err = NewParser().Parse([]byte("<134>Oct 11 22:14:15 host1 not a CEF:0|event|"), "")
+	c.Assert(err, IsNil)
+	c.Assert(log.Syslog.CEF, IsNil)
+	c.Assert(log.Warnings, HasLen, 0)
+}
+
+func (s *Rfc3164TestSuite) TestParser_LEEF(c *C) {
+	fixtures := []struct {
+		body     string
+		expected *parser.LEEF
+	}{
+		{
+			"<13>Oct 11 22:14:15 host1 LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=192.0.2.0\tdst=172.50.123.1\tmsg=a b=c",
+			&parser.LEEF{
+				Version: "1.0", Vendor: "Microsoft", Product: "MSExchange", ProductVersion: "4.0 SP1", EventID: "15345",
+				Delimiter: '\t',
+				Attributes: parser.Attributes{
+					{Key: "src", Value: "192.0.2.0"},
+					{Key: "dst", Value: "172.50.123.1"},
+					{Key: "msg", Value: "a b=c"},
+				},
+			},
+		},
+		{
+			"<13>Oct 11 22:14:15 host1 LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5^sev=5",
+			&parser.LEEF{
+				Version: "2.0", Vendor: "Lancope", Product: "StealthWatch", ProductVersion: "1.0", EventID: "41",
+				Delimiter: '^',
+				Attributes: parser.Attributes{
+					{Key: "src", Value: "10.0.1.8"},
+					{Key: "dst", Value: "10.0.0.5"},
+					{Key: "sev", Value: "5"},
+				},
+			},
+		},
+		{
+			"<13>Oct 11 22:14:15 host1 LEEF:2.0|V|P|1.0|41|x09|src=10.0.1.8\tdst=10.0.0.5",
+			&parser.LEEF{
+				Version: "2.0", Vendor: "V", Product: "P", ProductVersion: "1.0", EventID: "41",
+				Delimiter: '\t',
+				Attributes: parser.Attributes{
+					{Key: "src", Value: "10.0.1.8"},
+					{Key: "dst", Value: "10.0.0.5"},
+				},
+			},
+		},
+		{
+			"<13>Oct 11 22:14:15 host1 LEEF:2.0|V|P|1.0|41|0xa6|src=10.0.1.8¦dst=10.0.0.5",
+			&parser.LEEF{
+				Version: "2.0", Vendor: "V", Product: "P", ProductVersion: "1.0", EventID: "41",
+				Delimiter: '¦',
+				Attributes: parser.Attributes{
+					{Key: "src", Value: "10.0.1.8"},
+					{Key: "dst", Value: "10.0.0.5"},
+				},
+			},
+		},
+		{
+			// the delimiter is left out
+			"<13>Oct 11 22:14:15 host1 LEEF:2.0|V|P|1.0|41|src=10.0.1.8\tdst=10.0.0.5",
+			&parser.LEEF{
+				Version: "2.0", Vendor: "V", Product: "P", ProductVersion: "1.0", EventID: "41",
+				Delimiter: '\t',
+				Attributes: parser.Attributes{
+					{Key: "src", Value: "10.0.1.8"},
+					{Key: "dst", Value: "10.0.0.5"},
+				},
+			},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		log, err := NewParser().Parse([]byte(fixture.body), "")
+		c.Assert(err, IsNil)
+		c.Assert(log.Warnings, HasLen, 0, Commentf("log %s", fixture.body))
+		c.Assert(log.Syslog.LEEF, DeepEquals, fixture.expected, Commentf("log %s", fixture.body))
+	}
+
+	log, err := NewParser().Parse([]byte("<13>Oct 11 22:14:15 host1 LEEF:2.0|V|P|1.0|41|xzz|src=10.0.1.8"), "")
+	c.Assert(err, IsNil)
+	c.Assert(log.Syslog.LEEF, IsNil)
+	c.Assert(log.Warnings, HasLen, 1)
+	c.Assert(log.Warnings[0].Err, Equals, parser.ErrLEEFDelimiter)
+	c.Assert(log.Warnings[0].Field, Equals, "leef")
+	c.Assert(log.Warnings[0].Offset, Equals, 46)
+}
+
+func (s *Rfc3164TestSuite) TestParser_ParseLog(c *C) {
+	fixtures := []string{
+		"<34>Oct 11 22:14:15 mymachine very.large.syslog.message.tag: 'su root' failed for lonvick on /dev/pts/8",
+		"<34>Oct 11 22:14:15 mymachine singleword",
+		"<13>2003-10-11T22:14:15Z mymachine postfix/smtpd[99]: connect from unknown",
+	}
+
+	for _, fixture := range fixtures {
+		expected, err := NewParser().Parse([]byte(fixture), "192.0.2.1:514")
+		c.Assert(err, IsNil)
+
+		// a pooled log keeps the fields as slices until they are materialized
+		log := parser.AcquireLog([]byte(fixture))
+		c.Assert(NewParser().ParseLog(log, "192.0.2.1:514"), IsNil)
+		c.Assert(log.Header, HasLen, 0)
+		c.Assert(log.GetString("hostname"), Equals, expected.GetString("hostname"))
+		c.Assert(log.StructuredData(), DeepEquals, expected.StructuredData())
+
+		log.Materialize()
+		c.Assert(log.Header, DeepEquals, expected.Header)
+		c.Assert(log.Syslog, DeepEquals, expected.Syslog)
+
+		clone := log.Clone()
+		parser.ReleaseLog(log)
+		c.Assert(clone.Header, DeepEquals, expected.Header)
+		c.Assert(clone.Syslog, DeepEquals, expected.Syslog)
+	}
+}
+
+func BenchmarkParser_Parse(b *testing.B) {
+	buff := []byte("<34>Oct 11 22:14:15 mymachine very.large.syslog.message.tag: 'su root' failed for lonvick on /dev/pts/8")
+	p := NewParser()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Parse(buff, "192.0.2.1:514"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParser_ParseLog(b *testing.B) {
+	buff := []byte("<34>Oct 11 22:14:15 mymachine very.large.syslog.message.tag: 'su root' failed for lonvick on /dev/pts/8")
+	p := NewParser()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log := parser.AcquireLog(buff)
+		if err := p.ParseLog(log, "192.0.2.1:514"); err != nil {
+			b.Fatal(err)
+		}
+		parser.ReleaseLog(log)
+	}
+}
+
 func (s *Rfc3164TestSuite) assertTimeIsCloseToNow(c *C, obtainedTime time.Time) {
 	now := time.Now()
 	timeStart := now.Add(-(time.Second * 5))
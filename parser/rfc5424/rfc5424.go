@@ -1,17 +1,26 @@
 package rfc5424
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/crazy-airhead/gsyslog/parser"
-	"math"
-	"strconv"
 	"time"
+	"unicode/utf8"
 )
 
 const (
 	NilValue = '-'
 )
 
+var (
+	nilValue = []byte{NilValue}
+
+	// bom starts a MSG declared UTF-8, RFC5424 s6.4
+	bom = []byte{0xEF, 0xBB, 0xBF}
+	// replacement replaces the invalid UTF-8 sequences, U+FFFD
+	replacement = []byte(string(utf8.RuneError))
+)
+
 var (
 	ErrYearInvalid       = &parser.Error{Msg: "Invalid year in timestamp"}
 	ErrMonthInvalid      = &parser.Error{Msg: "Invalid month in timestamp"}
@@ -22,20 +31,46 @@ var (
 	ErrSecFracInvalid    = &parser.Error{Msg: "Invalid fraction of second in timestamp"}
 	ErrTimeZoneInvalid   = &parser.Error{Msg: "Invalid time zone in timestamp"}
 	ErrInvalidTimeFormat = &parser.Error{Msg: "Invalid time codec"}
+	ErrInvalidHostname   = &parser.Error{Msg: "Invalid hostname"}
 	ErrInvalidAppName    = &parser.Error{Msg: "Invalid app name"}
 	ErrInvalidProcId     = &parser.Error{Msg: "Invalid proc ID"}
 	ErrInvalidMsgId      = &parser.Error{Msg: "Invalid msg ID"}
-	ErrNoStructuredData  = &parser.Error{Msg: "No structured data"}
+	ErrPriorityInvalid   = &parser.Error{Msg: "Invalid priority"}
+	ErrVersionInvalid    = &parser.Error{Msg: "Invalid version"}
+	ErrInvalidUTF8       = &parser.Error{Msg: "Invalid UTF-8 in message"}
+	ErrNoStructuredData  = parser.ErrNoStructuredData
+
+	ErrInvalidSDID         = parser.ErrInvalidSDID
+	ErrInvalidSDParamName  = parser.ErrInvalidSDParamName
+	ErrInvalidSDParamValue = parser.ErrInvalidSDParamValue
+	ErrDuplicateSDID       = parser.ErrDuplicateSDID
+)
+
+// Mode tells how the parser handles a log deviating from the RFC5424 ABNF
+type Mode int
+
+const (
+	// Lenient tolerates the deviations it can parse around and adds each of them
+	// to Log.Warnings. A timestamp it can not parse is skipped, the log is only
+	// failed when its structure can not be found.
+	Lenient Mode = iota
+	// Strict enforces the whole ABNF, the first deviation fails the parsing with
+	// a *parser.ParseError giving its offset
+	Strict
 )
 
 type Parser struct {
+	mode Mode
+	// replaceInvalidUTF8 replaces the invalid UTF-8 sequences of MSG
+	replaceInvalidUTF8 bool
 }
 
 type partialTime struct {
 	hour    int
 	minute  int
 	seconds int
-	secFrac float64
+	// secFrac in nanoseconds
+	secFrac int
 }
 
 type fullTime struct {
@@ -53,95 +88,212 @@ func NewParser() *Parser {
 	return &Parser{}
 }
 
+// NewStrictParser returns a parser in Strict mode
+func NewStrictParser() *Parser {
+	return &Parser{mode: Strict}
+}
+
 func (p *Parser) Location(location *time.Location) {
 	// Ignore as RFC5424 syslog always has a timezone
 }
 
+// SetMode Sets how the deviations from the ABNF are handled, Lenient by default
+func (p *Parser) SetMode(mode Mode) {
+	p.mode = mode
+}
+
+// SetReplaceInvalidUTF8 Sets whether the invalid UTF-8 sequences of MSG are
+// replaced by U+FFFD, whether MSG is declared UTF-8 or not
+func (p *Parser) SetReplaceInvalidUTF8(replace bool) {
+	p.replaceInvalidUTF8 = replace
+}
+
 func (p *Parser) Parse(data []byte, client string) (*parser.Log, error) {
 	log := parser.NewLog(data)
-	err := p.parseHeader(log)
+	err := p.ParseLog(log, client)
+
+	return log, err
+}
+
+// ParseLog parses log.Body into log, see parser.LogParser
+func (p *Parser) ParseLog(log *parser.Log, client string) error {
+	log.SetClient(client)
+
+	err := p.parseLog(log)
 	if err != nil {
 		log.Err = err
-		return log, err
+		return err
+	}
+
+	return nil
+}
+
+// SYSLOG-MSG = HEADER SP STRUCTURED-DATA [SP MSG]
+func (p *Parser) parseLog(log *parser.Log) error {
+	err := p.parseHeader(log)
+	if err != nil {
+		return err
 	}
 
 	err = p.parseStructuredData(log)
 	if err != nil {
-		log.Err = err
-		return log, err
+		return err
 	}
 
 	log.MoveCursor()
 
 	if log.Cursor() < log.Len() {
-		log.SetMessage(string(log.Body[log.Cursor():]))
-	} else {
-		log.SetMessage("")
+		return p.parseMessage(log)
 	}
 
-	return log, nil
+	log.SetMessageBytes(nil)
+	return nil
+}
+
+// MSG = MSG-ANY / MSG-UTF8, MSG-UTF8 = BOM UTF-8-STRING. The BOM is removed and
+// a MSG-UTF8 is checked, it is a deviation for it not to be valid UTF-8.
+func (p *Parser) parseMessage(log *parser.Log) error {
+	from := log.Cursor()
+	msg := log.Body[from:]
+
+	declared := bytes.HasPrefix(msg, bom)
+	if declared {
+		msg = msg[len(bom):]
+		from += len(bom)
+	}
+
+	log.SetUTF8(declared)
+
+	if (declared || p.replaceInvalidUTF8) && !utf8.Valid(msg) {
+		if declared {
+			err := fieldError(log, ErrInvalidUTF8, "message", from+invalidUTF8(msg), "UTF-8-STRING")
+			if err := p.violate(log, err); err != nil {
+				return err
+			}
+		}
+
+		if p.replaceInvalidUTF8 {
+			msg = bytes.ToValidUTF8(msg, replacement)
+		}
+	}
+
+	log.SetMessageBytes(msg)
+	parser.ParsePayload(log, msg, from)
+
+	return nil
+}
+
+// invalidUTF8 returns the index of the first invalid UTF-8 sequence of b
+func invalidUTF8(b []byte) int {
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+
+		i += size
+	}
+
+	return len(b)
+}
+
+// violate handles a deviation from the ABNF: Strict fails with it, Lenient
+// adds it to the warnings of log
+func (p *Parser) violate(log *parser.Log, err *parser.ParseError) error {
+	if p.mode == Strict {
+		return err
+	}
+
+	log.AddWarning(err)
+	return nil
+}
+
+// fieldError returns the *parser.ParseError of err found at offset of log
+func fieldError(log *parser.Log, err error, field string, offset int, expected string) *parser.ParseError {
+	return parser.NewParseError(err, field, log.Body, offset, expected)
 }
 
 // HEADER = PRI VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID
 func (p *Parser) parseHeader(log *parser.Log) error {
-	err := parsePriority(log)
+	err := p.parsePriority(log)
 	if err != nil {
 		return err
 	}
 
-	err = parseVersion(log)
+	err = p.parseVersion(log)
 	if err != nil {
 		return err
 	}
 
-	// move over a blank
-	log.MoveCursor()
+	err = p.parseSpace(log, "timestamp")
+	if err != nil {
+		return err
+	}
 
 	err = p.parseTimestamp(log)
 	if err != nil {
 		return err
 	}
 
-	// move over a blank
-	log.MoveCursor()
+	err = p.parseSpace(log, "hostname")
+	if err != nil {
+		return err
+	}
 
-	err = parseHostname(log)
+	// HOSTNAME = NilValue / 1*255PRINTUSASCII
+	hostname, err := p.parseField(log, "hostname", 255, ErrInvalidHostname)
 	if err != nil {
 		return err
 	}
 
-	// move over a blank
-	log.MoveCursor()
+	log.SetHostnameBytes(hostname)
 
-	err = parseAppName(log)
+	err = p.parseSpace(log, "appName")
 	if err != nil {
 		return err
 	}
 
-	// move over a blank
-	log.MoveCursor()
+	// APP-NAME = NilValue / 1*48PRINTUSASCII
+	appName, err := p.parseField(log, "appName", 48, ErrInvalidAppName)
+	if err != nil {
+		return err
+	}
+
+	log.SetAppNameBytes(appName)
 
-	err = parseProcId(log)
+	err = p.parseSpace(log, "procId")
 	if err != nil {
-		return nil
+		return err
 	}
 
-	// move over a blank
-	log.MoveCursor()
+	// PROCID = NilValue / 1*128PRINTUSASCII
+	procId, err := p.parseField(log, "procId", 128, ErrInvalidProcId)
+	if err != nil {
+		return err
+	}
 
-	err = parseMsgId(log)
+	log.SetProcIdBytes(procId)
+
+	err = p.parseSpace(log, "msgId")
 	if err != nil {
-		return nil
+		return err
 	}
 
-	// move over a blank
-	log.MoveCursor()
+	// MSGID = NilValue / 1*32PRINTUSASCII
+	msgId, err := p.parseField(log, "msgId", 32, ErrInvalidMsgId)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	log.SetMsgIdBytes(msgId)
+
+	return p.parseSpace(log, "structuredData")
 }
 
-func parsePriority(log *parser.Log) error {
-	cursor := log.Cursor()
+// PRI = "<" PRIVAL ">", PRIVAL = 1*3DIGIT ; range 0 .. 191
+func (p *Parser) parsePriority(log *parser.Log) error {
+	from := log.Cursor()
+	cursor := from
 	priority, err := parser.ParsePriority(log.Body, &cursor, log.Len())
 	if err != nil {
 		// RFC3164 sec 4.3.3
@@ -149,7 +301,15 @@ func parsePriority(log *parser.Log) error {
 		log.SetFacility(1)
 		log.SetSeverity(5)
 
-		return err
+		return parser.NewPriorityError(err, log.Body, cursor)
+	}
+
+	// no leading zero but for <0>
+	prival := log.Body[from+1 : cursor-1]
+	if priority.P > 191 || (len(prival) > 1 && prival[0] == '0') {
+		if err := p.violate(log, fieldError(log, ErrPriorityInvalid, "priority", from+1, "PRIVAL 0-191")); err != nil {
+			return err
+		}
 	}
 
 	log.SetPriority(priority.P)
@@ -162,11 +322,29 @@ func parsePriority(log *parser.Log) error {
 	return nil
 }
 
-func parseVersion(log *parser.Log) error {
-	cursor := log.Cursor()
+// VERSION = NONZERO-DIGIT 0*2DIGIT, always 1 for RFC5424
+func (p *Parser) parseVersion(log *parser.Log) error {
+	from := log.Cursor()
+	cursor := from
 	version, err := parser.ParseVersion(log.Body, &cursor, log.Len())
 	if err != nil {
-		return err
+		return fieldError(log, err, "version", from, `"1"`)
+	}
+
+	if version == parser.NoVersion {
+		// the missing version is reported, not the byte after PRI
+		cursor = from
+	}
+
+	for version != parser.NoVersion && cursor < log.Len() && cursor-from < 3 && parser.IsDigit(log.Body[cursor]) {
+		version = version*10 + int(log.Body[cursor]-'0')
+		cursor++
+	}
+
+	if version != 1 || cursor-from != 1 {
+		if err := p.violate(log, fieldError(log, ErrVersionInvalid, "version", from, `"1" SP`)); err != nil {
+			return err
+		}
 	}
 
 	log.SetVersion(version)
@@ -177,52 +355,108 @@ func parseVersion(log *parser.Log) error {
 	return nil
 }
 
-// https://tools.ietf.org/html/rfc5424#section-6.2.3
-func (p *Parser) parseTimestamp(log *parser.Log) error {
-	var ts time.Time
-
+// parseSpace moves over the SP before field. Lenient skips whatever is left of
+// the previous field up to the SP.
+func (p *Parser) parseSpace(log *parser.Log, field string) error {
 	cursor := log.Cursor()
-	if cursor >= log.Len() {
-		return ErrInvalidTimeFormat
-	}
-
-	if log.Body[cursor] == NilValue {
+	if cursor < log.Len() && log.Body[cursor] == ' ' {
 		log.MoveCursor()
 		return nil
 	}
 
-	fd, err := parseFullDate(log.Body, &cursor, log.Len())
-	if err != nil {
+	if err := p.violate(log, fieldError(log, parser.ErrNoSpace, field, cursor, "SP")); err != nil {
 		return err
 	}
 
-	if cursor >= log.Len() || log.Body[cursor] != 'T' {
-		log.SetCursor(cursor)
-		return ErrInvalidTimeFormat
+	for cursor < log.Len() && log.Body[cursor] != ' ' {
+		cursor++
 	}
 
-	cursor++
+	if cursor < log.Len() {
+		cursor++
+	}
 
-	ft, err := parseFullTime(log.Body, &cursor, log.Len())
-	if err != nil {
-		log.SetCursor(cursor)
-		return parser.ErrTimestampUnknownFormat
+	log.SetCursor(cursor)
+	return nil
+}
+
+// parseField parses a field of 1 to maxLen PRINTUSASCII up to the next SP.
+// Lenient keeps an empty, too long or not printable field.
+func (p *Parser) parseField(log *parser.Log, field string, maxLen int, e error) ([]byte, error) {
+	from := log.Cursor()
+	to := from
+
+	for to < log.Len() && log.Body[to] != ' ' {
+		to++
 	}
 
-	nSec, err := toNSec(ft.pt.secFrac)
+	value := log.Body[from:to]
+
+	offset := -1
+	if len(value) == 0 {
+		offset = from
+	} else if len(value) > maxLen {
+		offset = from + maxLen
+	} else {
+		for i, c := range value {
+			if c < 33 || c > 126 {
+				offset = from + i
+				break
+			}
+		}
+	}
+
+	if offset >= 0 {
+		expected := fmt.Sprintf("NILVALUE or 1*%dPRINTUSASCII", maxLen)
+		if err := p.violate(log, fieldError(log, e, field, offset, expected)); err != nil {
+			return nil, err
+		}
+	}
+
+	log.SetCursor(to)
+	return value, nil
+}
+
+// https://tools.ietf.org/html/rfc5424#section-6.2.3
+// TIMESTAMP = NILVALUE / FULL-DATE "T" FULL-TIME
+func (p *Parser) parseTimestamp(log *parser.Log) error {
+	cursor := log.Cursor()
+	if cursor < log.Len() && log.Body[cursor] == NilValue {
+		log.MoveCursor()
+		return nil
+	}
+
+	from := cursor
+	fd, ft, err := parseDateTime(log.Body, &cursor, log.Len())
 	if err != nil {
+		if err := p.violate(log, fieldError(log, err, "timestamp", cursor, timestampExpected(err))); err != nil {
+			return err
+		}
+
+		// the timestamp is left unset, the next field follows the SP
+		for cursor < log.Len() && log.Body[cursor] != ' ' {
+			cursor++
+		}
+
 		log.SetCursor(cursor)
-		return err
+		return nil
+	}
+
+	if fd.day > daysIn(time.Month(fd.month), fd.year) {
+		// e.g. Feb 31, normalized by time.Date when tolerated
+		if err := p.violate(log, fieldError(log, ErrDayInvalid, "timestamp", from+len("2006-01-"), "DATE-MDAY of the month")); err != nil {
+			return err
+		}
 	}
 
-	ts = time.Date(
+	ts := time.Date(
 		fd.year,
 		time.Month(fd.month),
 		fd.day,
 		ft.pt.hour,
 		ft.pt.minute,
 		ft.pt.seconds,
-		nSec,
+		ft.pt.secFrac,
 		ft.loc,
 	)
 
@@ -234,66 +468,83 @@ func (p *Parser) parseTimestamp(log *parser.Log) error {
 	return nil
 }
 
-// HOSTNAME = NilValue / 1*255PRINTUSASCII
-func parseHostname(log *parser.Log) error {
-	cursor := log.Cursor()
-	hostname, err := parser.ParseHostname(log.Body, &cursor, log.Len())
-	if err != nil {
-		return err
-	}
+// FULL-DATE "T" FULL-TIME, the cursor is left where an error is found
+func parseDateTime(buff []byte, cursor *int, l int) (fullDate, fullTime, error) {
+	var ft fullTime
 
-	log.SetHostname(hostname)
-	log.SetCursor(cursor)
-	return nil
-}
+	if *cursor >= l {
+		return fullDate{}, ft, ErrInvalidTimeFormat
+	}
 
-// APP-NAME = NilValue / 1*48PRINTUSASCII
-func parseAppName(log *parser.Log) error {
-	cursor := log.Cursor()
-	appName, err := parseUpToLen(log.Body, &cursor, log.Len(), 48, ErrInvalidAppName)
+	fd, err := parseFullDate(buff, cursor, l)
 	if err != nil {
-		return err
+		return fd, ft, err
 	}
 
-	log.SetAppName(appName)
-	log.SetCursor(cursor)
-	return nil
-}
-
-// PROCID = NilValue / 1*128PRINTUSASCII
-func parseProcId(log *parser.Log) error {
-	cursor := log.Cursor()
-	procId, err := parseUpToLen(log.Body, &cursor, log.Len(), 128, ErrInvalidAppName)
-	if err != nil {
-		return err
+	if *cursor >= l || buff[*cursor] != 'T' {
+		return fd, ft, ErrInvalidTimeFormat
 	}
 
-	log.SetProcId(procId)
-	log.SetCursor(cursor)
-	return nil
+	*cursor++
+
+	ft, err = parseFullTime(buff, cursor, l)
+	return fd, ft, err
 }
 
-// MSGID = NilValue / 1*32PRINTUSASCII
-func parseMsgId(log *parser.Log) error {
-	cursor := log.Cursor()
-	msgId, err := parseUpToLen(log.Body, &cursor, log.Len(), 32, ErrInvalidAppName)
-	if err != nil {
-		return err
+// timestampExpected what TIMESTAMP expects where it failed with err
+func timestampExpected(err error) string {
+	switch err {
+	case ErrYearInvalid:
+		return "DATE-FULLYEAR"
+	case ErrMonthInvalid:
+		return "DATE-MONTH"
+	case ErrDayInvalid:
+		return "DATE-MDAY"
+	case ErrHourInvalid:
+		return "TIME-HOUR"
+	case ErrMinuteInvalid:
+		return "TIME-MINUTE"
+	case ErrSecondInvalid:
+		return "TIME-SECOND"
+	case ErrSecFracInvalid:
+		return "TIME-SECFRAC"
+	case ErrTimeZoneInvalid:
+		return "TIME-OFFSET"
+	case parser.ErrTimestampUnknownFormat:
+		return `"-"`
 	}
 
-	log.SetMsgId(msgId)
-	log.SetCursor(cursor)
-	return nil
+	return "NILVALUE or FULL-DATE \"T\" FULL-TIME"
+}
+
+// daysIn the number of days of month in year
+func daysIn(month time.Month, year int) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
 }
 
+// STRUCTURED-DATA = NILVALUE / 1*SD-ELEMENT
 func (p *Parser) parseStructuredData(log *parser.Log) error {
-	cursor := log.Cursor()
-	sd, err := parseStructuredData(log.Body, &cursor, log.Len())
+	from := log.Cursor()
+	cursor := from
+	err := parser.ValidateStructuredData(log.Body, &cursor, log.Len(), func(err *parser.ParseError) error {
+		return p.violate(log, err)
+	})
 	if err != nil {
+		log.SetCursor(cursor)
 		return err
 	}
 
-	log.SetStructuredData(sd)
+	if cursor == from {
+		// no STRUCTURED-DATA at the end of the log
+		if err := p.violate(log, fieldError(log, ErrNoStructuredData, "structuredData", from, "NILVALUE or SD-ELEMENT")); err != nil {
+			return err
+		}
+
+		log.SetStructuredDataBytes(nilValue)
+	} else {
+		log.SetStructuredDataBytes(log.Body[from:cursor])
+	}
+
 	log.SetCursor(cursor)
 	return nil
 }
@@ -348,15 +599,13 @@ func parseYear(buff []byte, cursor *int, l int) (int, error) {
 
 	// XXX : we do not check for a valid year (ie. 1999, 2013 etc)
 	// XXX : we only checks the format is correct
-	sub := string(buff[*cursor : *cursor+yearLen])
-
-	*cursor += yearLen
-
-	year, err := strconv.Atoi(sub)
-	if err != nil {
+	year, ok := parser.ParseDigits(buff[*cursor : *cursor+yearLen])
+	if !ok {
 		return 0, ErrYearInvalid
 	}
 
+	*cursor += yearLen
+
 	return year, nil
 }
 
@@ -365,18 +614,14 @@ func parseMonth(buff []byte, cursor *int, l int) (int, error) {
 	return parser.Parse2Digits(buff, cursor, l, 1, 12, ErrMonthInvalid)
 }
 
-// DATE-MDAY = 2DIGIT  ; 01-28, 01-29, 01-30, 01-31 based on month/year
+// DATE-MDAY = 2DIGIT  ; 01-28, 01-29, 01-30, 01-31 based on month/year, the
+// month and the year are checked by parseDateTime
 func parseDay(buff []byte, cursor *int, l int) (int, error) {
-	// XXX : this is a relaxed constraint
-	// XXX : we do not check if valid regarding February or leap years
-	// XXX : we only checks that day is in range [01 -> 31]
-	// XXX : in other words this function will not rant if you provide Feb 31th
 	return parser.Parse2Digits(buff, cursor, l, 1, 31, ErrDayInvalid)
 }
 
 // FULL-TIME = PARTIAL-TIME TIME-OFFSET
 func parseFullTime(buff []byte, cursor *int, l int) (fullTime, error) {
-	var loc = new(time.Location)
 	var ft fullTime
 
 	pt, err := parsePartialTime(buff, cursor, l)
@@ -384,7 +629,7 @@ func parseFullTime(buff []byte, cursor *int, l int) (fullTime, error) {
 		return ft, err
 	}
 
-	loc, err = parseTimeOffset(buff, cursor, l)
+	loc, err := parseTimeOffset(buff, cursor, l)
 	if err != nil {
 		return ft, err
 	}
@@ -435,7 +680,7 @@ func parsePartialTime(buff []byte, cursor *int, l int) (partialTime, error) {
 
 	secFrac, err := parseSecFrac(buff, cursor, l)
 	if err != nil {
-		return pt, nil
+		return pt, err
 	}
 	pt.secFrac = secFrac
 
@@ -457,8 +702,9 @@ func parseSecond(buff []byte, cursor *int, l int) (int, error) {
 	return parser.Parse2Digits(buff, cursor, l, 0, 59, ErrSecondInvalid)
 }
 
-// TIME-SECFRAC = "." 1*6DIGIT
-func parseSecFrac(buff []byte, cursor *int, l int) (float64, error) {
+// TIME-SECFRAC = "." 1*6DIGIT, in nanoseconds. Without digit or with more
+// than 6, the cursor is left on the failing byte.
+func parseSecFrac(buff []byte, cursor *int, l int) (int, error) {
 	maxDigitLen := 6
 
 	max := *cursor + maxDigitLen
@@ -476,24 +722,32 @@ func parseSecFrac(buff []byte, cursor *int, l int) (float64, error) {
 		}
 	}
 
-	sub := string(buff[from:to])
-	if len(sub) == 0 {
+	if to == from || (to < l && parser.IsDigit(buff[to])) {
+		*cursor = to
 		return 0, ErrSecFracInvalid
 	}
 
-	secFrac, err := strconv.ParseFloat("0."+sub, 64)
-	*cursor = to
-	if err != nil {
+	secFrac, ok := parser.ParseDigits(buff[from:to])
+	if !ok {
 		return 0, ErrSecFracInvalid
 	}
 
+	*cursor = to
+
+	for digits := to - from; digits < 9; digits++ {
+		secFrac *= 10
+	}
+
 	return secFrac, nil
 }
 
 // TIME-OFFSET = "Z" / TIME-NUMOFFSET
 func parseTimeOffset(buff []byte, cursor *int, l int) (*time.Location, error) {
+	if *cursor >= l {
+		return nil, ErrTimeZoneInvalid
+	}
 
-	if *cursor >= l || buff[*cursor] == 'Z' {
+	if buff[*cursor] == 'Z' {
 		*cursor++
 		return time.UTC, nil
 	}
@@ -503,28 +757,26 @@ func parseTimeOffset(buff []byte, cursor *int, l int) (*time.Location, error) {
 
 // TIME-NUMOFFSET  = ("+" / "-") TIME-HOUR ":" TIME-MINUTE
 func parseNumericalTimeOffset(buff []byte, cursor *int, l int) (*time.Location, error) {
-	var loc = new(time.Location)
-
 	sign := buff[*cursor]
 
 	if (sign != '+') && (sign != '-') {
-		return loc, ErrTimeZoneInvalid
+		return nil, ErrTimeZoneInvalid
 	}
 
 	*cursor++
 
 	hour, minute, err := getHourMinute(buff, cursor, l)
 	if err != nil {
-		return loc, err
+		return nil, err
 	}
 
-	tzStr := fmt.Sprintf("%s%02d:%02d", string(sign), hour, minute)
-	tmpTs, err := time.Parse("-07:00", tzStr)
-	if err != nil {
-		return loc, err
+	offset := hour*3600 + minute*60
+	if sign == '-' {
+		offset = -offset
 	}
 
-	return tmpTs.Location(), nil
+	// the unnamed zones of whole hours are cached by the time package
+	return time.FixedZone("", offset), nil
 }
 
 func getHourMinute(buff []byte, cursor *int, l int) (int, int, error) {
@@ -546,92 +798,3 @@ func getHourMinute(buff []byte, cursor *int, l int) (int, int, error) {
 
 	return hour, minute, nil
 }
-
-func toNSec(sec float64) (int, error) {
-	_, frac := math.Modf(sec)
-	fracStr := strconv.FormatFloat(frac, 'f', 9, 64)
-	fracInt, err := strconv.Atoi(fracStr[2:])
-	if err != nil {
-		return 0, err
-	}
-
-	return fracInt, nil
-}
-
-// ------------------------------------------------
-// https://tools.ietf.org/html/rfc5424#section-6.3
-// ------------------------------------------------
-
-func parseStructuredData(buff []byte, cursor *int, l int) (string, error) {
-	var sdData string
-	var found bool
-
-	if *cursor >= l {
-		return "-", nil
-	}
-
-	if buff[*cursor] == NilValue {
-		*cursor++
-		return "-", nil
-	}
-
-	if buff[*cursor] != '[' {
-		return sdData, ErrNoStructuredData
-	}
-
-	from := *cursor
-	to := from
-
-	for to = from; to < l; to++ {
-		if found {
-			break
-		}
-
-		b := buff[to]
-
-		if b == ']' {
-			switch t := to + 1; {
-			case t == l:
-				found = true
-			case t <= l && buff[t] == ' ':
-				found = true
-			}
-		}
-	}
-
-	if found {
-		*cursor = to
-		return string(buff[from:to]), nil
-	}
-
-	return sdData, ErrNoStructuredData
-}
-
-func parseUpToLen(buff []byte, cursor *int, l int, maxLen int, e error) (string, error) {
-	var to int
-	var found bool
-	var result string
-
-	max := *cursor + maxLen
-
-	for to = *cursor; (to <= max) && (to < l); to++ {
-		if buff[to] == ' ' {
-			found = true
-			break
-		}
-	}
-
-	if found {
-		result = string(buff[*cursor:to])
-	} else if to > max {
-		to = max // don't go past max
-	}
-
-	*cursor = to
-
-	if found {
-		return result, nil
-	}
-
-	return "", e
-}
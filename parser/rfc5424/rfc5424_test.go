@@ -1,6 +1,9 @@
 package rfc5424
 
 import (
+	"errors"
+	"github.com/crazy-airhead/gsyslog/parser"
+	"strings"
 	"testing"
 	"time"
 
@@ -34,6 +37,7 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 
 	expected := []map[string]interface{}{
 		{
+			"client":         "",
 			"priority":       34,
 			"facility":       4,
 			"severity":       2,
@@ -47,6 +51,7 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 			"message":        "'su root' failed for lonvick on /dev/pts/8",
 		},
 		{
+			"client":         "",
 			"priority":       165,
 			"facility":       20,
 			"severity":       5,
@@ -60,6 +65,7 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 			"message":        "%% It's time to make the do-nuts.",
 		},
 		{
+			"client":         "",
 			"priority":       165,
 			"facility":       20,
 			"severity":       5,
@@ -73,6 +79,7 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 			"message":        "%% It's time to make the do-nuts.",
 		},
 		{
+			"client":         "",
 			"priority":       165,
 			"facility":       20,
 			"severity":       5,
@@ -86,6 +93,7 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 			"message":        "An application event log entry...",
 		},
 		{
+			"client":         "",
 			"priority":       165,
 			"facility":       20,
 			"severity":       5,
@@ -99,6 +107,7 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 			"message":        "",
 		},
 		{
+			"client":         "",
 			"priority":       165,
 			"facility":       20,
 			"severity":       5,
@@ -128,6 +137,431 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 	}
 }
 
+func (s *Rfc5424TestSuite) TestParser_Syslog(c *C) {
+	buff := []byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3"] An application event log entry...`)
+
+	obtained, err := NewParser().Parse(buff, "192.0.2.1:514")
+	c.Assert(err, IsNil)
+
+	ts := time.Date(2003, time.October, 11, 22, 14, 15, 3*10e5, time.UTC)
+	hostname := "mymachine.example.com"
+	appName := "evntslog"
+	msgId := "ID47"
+	expected := parser.SyslogMessage{
+		Priority:  165,
+		Facility:  20,
+		Severity:  5,
+		Version:   1,
+		Timestamp: &ts,
+		Hostname:  &hostname,
+		AppName:   &appName,
+		MsgID:     &msgId,
+		StructuredData: parser.StructuredData{
+			{ID: "exampleSDID@32473", Params: []parser.SDParam{{Name: "iut", Value: "3"}}},
+		},
+		Message: "An application event log entry...",
+		Client:  "192.0.2.1:514",
+	}
+
+	c.Assert(obtained.Syslog, DeepEquals, expected)
+
+	// every NILVALUE is nil
+	buff = []byte("<165>1 - - - - - - msg")
+
+	obtained, err = NewParser().Parse(buff, "")
+	c.Assert(err, IsNil)
+	c.Assert(obtained.Syslog, DeepEquals, parser.SyslogMessage{
+		Priority: 165,
+		Facility: 20,
+		Severity: 5,
+		Version:  1,
+		Message:  "msg",
+	})
+}
+
+func (s *Rfc5424TestSuite) TestParser_StructuredData(c *C) {
+	header := "<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 "
+
+	fixtures := []string{
+		`[exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high"] msg`,
+		// "] " inside a quoted value and escapes
+		`[exampleSDID@32473 path="a] b" quote="say \"hi\"" backslash="c:\\tmp" bracket="\]" other="\n"] msg`,
+		// duplicate param names, IANA registered SD-ID without params
+		`[origin ip="192.0.2.1" ip="192.0.2.2"][timeQuality] msg`,
+		"-",
+	}
+
+	expected := []parser.StructuredData{
+		{
+			{ID: "exampleSDID@32473", Params: []parser.SDParam{
+				{Name: "iut", Value: "3"},
+				{Name: "eventSource", Value: "Application"},
+				{Name: "eventID", Value: "1011"},
+			}},
+			{ID: "examplePriority@32473", Params: []parser.SDParam{{Name: "class", Value: "high"}}},
+		},
+		{
+			{ID: "exampleSDID@32473", Params: []parser.SDParam{
+				{Name: "path", Value: "a] b"},
+				{Name: "quote", Value: `say "hi"`},
+				{Name: "backslash", Value: `c:\tmp`},
+				{Name: "bracket", Value: "]"},
+				{Name: "other", Value: `\n`},
+			}},
+		},
+		{
+			{ID: "origin", Params: []parser.SDParam{{Name: "ip", Value: "192.0.2.1"}, {Name: "ip", Value: "192.0.2.2"}}},
+			{ID: "timeQuality"},
+		},
+		nil,
+	}
+
+	for i, fixture := range fixtures {
+		obtained, err := NewParser().Parse([]byte(header+fixture), "")
+		c.Assert(err, IsNil)
+		c.Assert(obtained.StructuredData(), DeepEquals, expected[i])
+
+		if expected[i] != nil {
+			c.Assert(obtained.GetString("message"), Equals, "msg")
+		}
+	}
+
+	obtained, err := NewParser().Parse([]byte(header+fixtures[0]), "")
+	c.Assert(err, IsNil)
+
+	value, ok := obtained.SDParam("exampleSDID@32473", "eventID")
+	c.Assert(ok, Equals, true)
+	c.Assert(value, Equals, "1011")
+
+	_, ok = obtained.SDParam("exampleSDID@32473", "missing")
+	c.Assert(ok, Equals, false)
+
+	obtained, err = NewParser().Parse([]byte(header+fixtures[2]), "")
+	c.Assert(err, IsNil)
+
+	origin, ok := obtained.StructuredData().Element("origin")
+	c.Assert(ok, Equals, true)
+	c.Assert(origin.Values("ip"), DeepEquals, []string{"192.0.2.1", "192.0.2.2"})
+}
+
+func (s *Rfc5424TestSuite) TestParser_StructuredDataInvalid(c *C) {
+	header := "<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 "
+
+	fixtures := []string{
+		`[] msg`,
+		`[@32473 a="1"]`,
+		`[exampleSDID@ a="1"]`,
+		`[exampleSDID@abc a="1"]`,
+		`[exampleSDID@32473" a="1"]`,
+		`[exampleSDIDexampleSDIDexampleSDID@32473 a="1"]`,
+		`[exampleSDID@32473 ="1"]`,
+		`[exampleSDID@32473 a"1"]`,
+		`[exampleSDID@32473 a=1]`,
+		`[exampleSDID@32473 a="1]`,
+		`[exampleSDID@32473 a="1"`,
+		`[exampleSDID@32473 a="1"]msg`,
+		`msg`,
+	}
+
+	expected := []error{
+		ErrInvalidSDID,
+		ErrInvalidSDID,
+		ErrInvalidSDID,
+		ErrInvalidSDID,
+		ErrInvalidSDID,
+		ErrInvalidSDID,
+		ErrInvalidSDParamName,
+		ErrInvalidSDParamName,
+		ErrInvalidSDParamValue,
+		ErrInvalidSDParamValue,
+		ErrNoStructuredData,
+		ErrNoStructuredData,
+		ErrNoStructuredData,
+	}
+
+	c.Assert(len(fixtures), Equals, len(expected))
+
+	for i, fixture := range fixtures {
+		_, err := NewParser().Parse([]byte(header+fixture), "")
+		c.Assert(errors.Is(err, expected[i]), Equals, true, Commentf("fixture %s: %v", fixture, err))
+	}
+}
+
+func (s *Rfc5424TestSuite) TestParser_Message(c *C) {
+	header := "<165>1 - - - - - - "
+
+	// the BOM declares the MSG UTF-8 and is not part of it
+	log, err := NewParser().Parse([]byte(header+"\xEF\xBB\xBFcafé"), "")
+	c.Assert(err, IsNil)
+	c.Assert(log.GetString("message"), Equals, "café")
+	c.Assert(log.Syslog.UTF8, Equals, true)
+	c.Assert(log.Warnings, HasLen, 0)
+
+	log, err = NewParser().Parse([]byte(header+"caf\xe9"), "")
+	c.Assert(err, IsNil)
+	c.Assert(log.GetString("message"), Equals, "caf\xe9")
+	c.Assert(log.Syslog.UTF8, Equals, false)
+	c.Assert(log.Warnings, HasLen, 0)
+
+	// a MSG-UTF8 must be valid UTF-8
+	invalid := []byte(header + "\xEF\xBB\xBFbad\xff\xfe utf-8")
+
+	log, err = NewParser().Parse(invalid, "")
+	c.Assert(err, IsNil)
+	c.Assert(log.GetString("message"), Equals, "bad\xff\xfe utf-8")
+	c.Assert(log.Warnings, HasLen, 1)
+	c.Assert(log.Warnings[0].Err, Equals, ErrInvalidUTF8)
+	c.Assert(log.Warnings[0].Offset, Equals, 25)
+
+	_, err = NewStrictParser().Parse(invalid, "")
+	c.Assert(errors.Is(err, ErrInvalidUTF8), Equals, true)
+
+	// the invalid sequences are replaced when asked for, declared UTF-8 or not
+	p := NewParser()
+	p.SetReplaceInvalidUTF8(true)
+
+	log, err = p.Parse(invalid, "")
+	c.Assert(err, IsNil)
+	c.Assert(log.GetString("message"), Equals, "bad\uFFFD utf-8")
+
+	log = parser.AcquireLog([]byte(header + "caf\xe9"))
+	c.Assert(p.ParseLog(log, ""), IsNil)
+	c.Assert(log.GetString("message"), Equals, "caf\uFFFD")
+	parser.ReleaseLog(log)
+}
+
+func (s *Rfc5424TestSuite) TestParser_CEF(c *C) {
+	body := "<134>1 2003-10-11T22:14:15.003Z host1 app - - - " +
+		`CEF:0|Vendor|Product|1.0|42|Path c:\\temp|5|filePath=c:\\temp\\a b.txt request=/a?b\=c msg=line 1\nline 2`
+
+	log, err := NewParser().Parse([]byte(body), "")
+	c.Assert(err, IsNil)
+	c.Assert(log.Warnings, HasLen, 0)
+	c.Assert(log.Syslog.CEF, NotNil)
+	c.Assert(log.Syslog.CEF.Name, Equals, `Path c:\temp`)
+	c.Assert(log.Syslog.CEF.Extension, DeepEquals, parser.Attributes{
+		{Key: "filePath", Value: `c:\temp\a b.txt`},
+		{Key: "request", Value: "/a?b=c"},
+		{Key: "msg", Value: "line 1\nline 2"},
+	})
+
+	value, ok := log.Syslog.CEF.Extension.Get("request")
+	c.Assert(ok, Equals, true)
+	c.Assert(value, Equals, "/a?b=c")
+
+	_, ok = log.Syslog.CEF.Extension.Get("src")
+	c.Assert(ok, Equals, false)
+
+	// the offset of a warning is the one of the log
+	log, err = NewParser().Parse([]byte("<134>1 - - - - - - CEF:x|Vendor"), "")
+	c.Assert(err, IsNil)
+	c.Assert(log.Syslog.CEF, IsNil)
+	c.Assert(log.Warnings, HasLen, 1)
+	c.Assert(log.Warnings[0].Err, Equals, parser.ErrCEFVersion)
+	c.Assert(log.Warnings[0].Offset, Equals, 23)
+}
+
+func (s *Rfc5424TestSuite) TestParser_LEEF(c *C) {
+	// a Latin-1 delimiter sent as is
+	body := "<13>1 2003-10-11T22:14:15.003Z host1 app - - - LEEF:2.0|V|P|1.0|41|xa6|src=10.0.1.8\xa6usrName=a\\|b"
+
+	log, err := NewParser().Parse([]byte(body), "")
+	c.Assert(err, IsNil)
+	c.Assert(log.Warnings, HasLen, 0)
+	c.Assert(log.Syslog.LEEF, NotNil)
+	c.Assert(log.Syslog.LEEF.EventID, Equals, "41")
+	c.Assert(log.Syslog.LEEF.Delimiter, Equals, '¦')
+	c.Assert(log.Syslog.LEEF.Attributes, DeepEquals, parser.Attributes{
+		{Key: "src", Value: "10.0.1.8"},
+		{Key: "usrName", Value: "a\\|b"},
+	})
+
+	log, err = NewParser().Parse([]byte("<13>1 - - - - - - LEEF:x|V"), "")
+	c.Assert(err, IsNil)
+	c.Assert(log.Syslog.LEEF, IsNil)
+	c.Assert(log.Warnings, HasLen, 1)
+	c.Assert(log.Warnings[0].Err, Equals, parser.ErrLEEFVersion)
+	c.Assert(log.Warnings[0].Offset, Equals, 23)
+}
+
+func (s *Rfc5424TestSuite) TestParser_Error(c *C) {
+	log, err := NewParser().Parse([]byte(`<165>1 - - - - - [id@1 a=1] msg`), "")
+	c.Assert(log.Err, Equals, err)
+	c.Assert(errors.Is(err, ErrInvalidSDParamValue), Equals, true)
+	c.Assert(err, DeepEquals, &parser.ParseError{
+		Err:      ErrInvalidSDParamValue,
+		Field:    "structuredData",
+		Offset:   25,
+		Expected: "%d34",
+		Actual:   []byte("1] msg"),
+	})
+	c.Assert(err.Error(), Equals, `structuredData: Invalid param value in structured data at offset 25, expected %d34, found "1] msg"`)
+
+	_, err = NewParser().Parse([]byte(`<165`), "")
+	c.Assert(errors.Is(err, parser.ErrPriorityNoEnd), Equals, true)
+	c.Assert(err.Error(), Equals, `priority: No end char found for priority at offset 4, expected ">", found end of log`)
+
+	// the bytes found are kept once a pooled log is released
+	log = parser.AcquireLog([]byte("<165>1 2003-13-11T22:14:15.003Z host app - ID47 - msg"))
+	c.Assert(NewStrictParser().ParseLog(log, ""), NotNil)
+
+	err = log.Err
+	parser.ReleaseLog(log)
+	c.Assert(err, DeepEquals, &parser.ParseError{
+		Err:      ErrMonthInvalid,
+		Field:    "timestamp",
+		Offset:   12,
+		Expected: "DATE-MONTH",
+		Actual:   []byte("13-11T22:14:15.0"),
+	})
+
+	// a TIME-SECFRAC without digit is not skipped
+	_, err = NewStrictParser().Parse([]byte("<165>1 2003-10-11T22:14:15.Z host app - ID47 - msg"), "")
+	c.Assert(err, DeepEquals, &parser.ParseError{
+		Err:      ErrSecFracInvalid,
+		Field:    "timestamp",
+		Offset:   27,
+		Expected: "TIME-SECFRAC",
+		Actual:   []byte("Z host app - ID4"),
+	})
+}
+
+// violations of the ABNF with the offset where they are found
+var violations = []struct {
+	log    string
+	err    error
+	field  string
+	offset int
+}{
+	{"<165>2 2003-10-11T22:14:15.003Z host app - ID47 - msg", ErrVersionInvalid, "version", 5},
+	{"<165>10 2003-10-11T22:14:15.003Z host app - ID47 - msg", ErrVersionInvalid, "version", 5},
+	{"<192>1 2003-10-11T22:14:15.003Z host app - ID47 - msg", ErrPriorityInvalid, "priority", 1},
+	{"<01>1 2003-10-11T22:14:15.003Z host app - ID47 - msg", ErrPriorityInvalid, "priority", 1},
+	{"<165>1 2003-02-31T22:14:15.003Z host app - ID47 - msg", ErrDayInvalid, "timestamp", 15},
+	{"<165>1 2003-10-11T22:14:15 host app - ID47 - msg", ErrTimeZoneInvalid, "timestamp", 26},
+	{"<165>1 2003-10-11T22:14:15.Z host app - ID47 - msg", ErrSecFracInvalid, "timestamp", 27},
+	{"<165>1 2003-10-11T22:14:15. host app - ID47 - msg", ErrSecFracInvalid, "timestamp", 27},
+	{"<165>1 2003-10-11T22:14:15.1234567Z host app - ID47 - msg", ErrSecFracInvalid, "timestamp", 33},
+	{"<165>1 2003-10-11T22:14:15.003Z host\x01 app - ID47 - msg", ErrInvalidHostname, "hostname", 36},
+	{"<165>1 2003-10-11T22:14:15.003Z host " + strings.Repeat("a", 49) + " - ID47 - msg", ErrInvalidAppName, "appName", 85},
+	{"<165>1 2003-10-11T22:14:15.003Z host app 87\t10 ID47 - msg", ErrInvalidProcId, "procId", 43},
+	{"<165>1 2003-10-11T22:14:15.003Z host app - ID47\x7f - msg", ErrInvalidMsgId, "msgId", 47},
+	{"<165>1 2003-10-11T22:14:15.003Z host app - ID47", parser.ErrNoSpace, "structuredData", 47},
+	{`<165>1 2003-10-11T22:14:15.003Z host app - ID47 [id@1 a="1"  b="2"] msg`, ErrInvalidSDParamName, "structuredData", 60},
+	{`<165>1 2003-10-11T22:14:15.003Z host app - ID47 [id@1 a="1"b="2"] msg`, ErrInvalidSDParamName, "structuredData", 59},
+	{`<165>1 2003-10-11T22:14:15.003Z host app - ID47 [id@1 a="1" ] msg`, ErrInvalidSDParamName, "structuredData", 59},
+	{`<165>1 2003-10-11T22:14:15.003Z host app - ID47 [id@1 a= "1"] msg`, ErrInvalidSDParamValue, "structuredData", 56},
+	{`<165>1 2003-10-11T22:14:15.003Z host app - ID47 [id@1 a="]"] msg`, ErrInvalidSDParamValue, "structuredData", 57},
+	{`<165>1 2003-10-11T22:14:15.003Z host app - ID47 [id a="1"] msg`, ErrInvalidSDID, "structuredData", 49},
+	{`<165>1 2003-10-11T22:14:15.003Z host app - ID47 [id@1 a="1"][id@1 b="2"] msg`, ErrDuplicateSDID, "structuredData", 61},
+}
+
+func (s *Rfc5424TestSuite) TestParser_Strict(c *C) {
+	valid := []string{
+		"<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed for lonvick on /dev/pts/8",
+		`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][origin ip="192.0.2.1"]`,
+		"<0>1 2004-02-29T22:14:15Z - - - - -",
+	}
+
+	for _, fixture := range valid {
+		log, err := NewStrictParser().Parse([]byte(fixture), "")
+		c.Assert(err, IsNil, Commentf("fixture %s", fixture))
+		c.Assert(log.Warnings, HasLen, 0)
+	}
+
+	for _, v := range violations {
+		log, err := NewStrictParser().Parse([]byte(v.log), "")
+		c.Assert(errors.Is(err, v.err), Equals, true, Commentf("fixture %q: %v", v.log, err))
+		c.Assert(log.Err, Equals, err)
+
+		var parseErr *parser.ParseError
+		c.Assert(errors.As(err, &parseErr), Equals, true)
+		c.Assert(parseErr.Field, Equals, v.field, Commentf("fixture %q", v.log))
+		c.Assert(parseErr.Offset, Equals, v.offset, Commentf("fixture %q", v.log))
+	}
+}
+
+func (s *Rfc5424TestSuite) TestParser_Lenient(c *C) {
+	for _, v := range violations {
+		log, err := NewParser().Parse([]byte(v.log), "")
+		c.Assert(err, IsNil, Commentf("fixture %q", v.log))
+		c.Assert(len(log.Warnings) > 0, Equals, true, Commentf("fixture %q", v.log))
+		c.Assert(log.Warnings[0].Err, Equals, v.err)
+		c.Assert(log.Warnings[0].Field, Equals, v.field)
+		c.Assert(log.Warnings[0].Offset, Equals, v.offset)
+	}
+
+	// the fields after a timestamp that can not be parsed are still extracted
+	log, err := NewParser().Parse([]byte("<165>1 2003-10-11T22:14:15 host app - ID47 - msg"), "")
+	c.Assert(err, IsNil)
+	c.Assert(log.Syslog.Timestamp, IsNil)
+	c.Assert(*log.Syslog.Hostname, Equals, "host")
+	c.Assert(log.Syslog.Message, Equals, "msg")
+
+	// the errors of PROCID and MSGID are no longer lost
+	p := NewParser()
+	p.SetMode(Strict)
+	_, err = p.Parse([]byte("<165>1 2003-10-11T22:14:15.003Z host app "+strings.Repeat("1", 129)+" ID47 - msg"), "")
+	c.Assert(errors.Is(err, ErrInvalidProcId), Equals, true)
+	_, err = p.Parse([]byte("<165>1 2003-10-11T22:14:15.003Z host app - "+strings.Repeat("a", 33)+" - msg"), "")
+	c.Assert(errors.Is(err, ErrInvalidMsgId), Equals, true)
+}
+
+func (s *Rfc5424TestSuite) TestParser_ParseLog(c *C) {
+	fixtures := []string{
+		`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] An application event log entry...`,
+		"<165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - - %% It's time to make the do-nuts.",
+		"<34>1 - - - - - -",
+	}
+
+	for _, fixture := range fixtures {
+		expected, err := NewParser().Parse([]byte(fixture), "192.0.2.1:514")
+		c.Assert(err, IsNil)
+
+		// a pooled log keeps the fields as slices until they are materialized
+		log := parser.AcquireLog([]byte(fixture))
+		c.Assert(NewParser().ParseLog(log, "192.0.2.1:514"), IsNil)
+		c.Assert(log.Header, HasLen, 0)
+		c.Assert(log.GetString("hostname"), Equals, expected.GetString("hostname"))
+		c.Assert(log.StructuredData(), DeepEquals, expected.StructuredData())
+
+		log.Materialize()
+		c.Assert(log.Header, DeepEquals, expected.Header)
+		c.Assert(log.Syslog, DeepEquals, expected.Syslog)
+
+		clone := log.Clone()
+		parser.ReleaseLog(log)
+		c.Assert(clone.Header, DeepEquals, expected.Header)
+		c.Assert(clone.Syslog, DeepEquals, expected.Syslog)
+	}
+}
+
+func BenchmarkParser_Parse(b *testing.B) {
+	buff := []byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] An application event log entry...`)
+	p := NewParser()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Parse(buff, "192.0.2.1:514"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParser_ParseLog(b *testing.B) {
+	buff := []byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] An application event log entry...`)
+	p := NewParser()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log := parser.AcquireLog(buff)
+		if err := p.ParseLog(log, "192.0.2.1:514"); err != nil {
+			b.Fatal(err)
+		}
+		parser.ReleaseLog(log)
+	}
+}
+
 //func (s *Rfc5424TestSuite) TestParser_Truncated(c *C) {
 //	msg := "<165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - - %% It's time to make the do-nuts."
 //	for i := range msg {
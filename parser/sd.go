@@ -0,0 +1,400 @@
+package parser
+
+import "bytes"
+
+// https://tools.ietf.org/html/rfc5424#section-6.3
+
+var (
+	ErrNoStructuredData    = &Error{Msg: "No structured data"}
+	ErrInvalidSDID         = &Error{Msg: "Invalid SD-ID in structured data"}
+	ErrInvalidSDParamName  = &Error{Msg: "Invalid param name in structured data"}
+	ErrInvalidSDParamValue = &Error{Msg: "Invalid param value in structured data"}
+	ErrDuplicateSDID       = &Error{Msg: "Duplicate SD-ID in structured data"}
+)
+
+// registeredSDIDs the IANA registered SD-IDs, any other SD-ID must be name@<private enterprise number>
+var registeredSDIDs = []string{"timeQuality", "origin", "meta"}
+
+// Violation is called with each deviation from the ABNF that the parsing of the
+// structured data tolerates. A non nil error stops the parsing with it.
+type Violation func(err *ParseError) error
+
+// SDParam PARAM-NAME "=" %d34 PARAM-VALUE %d34, the value is unescaped
+type SDParam struct {
+	Name  string
+	Value string
+}
+
+// SDElement "[" SD-ID *(SP SD-PARAM) "]", the params are kept in order and
+// a param name may appear more than once
+type SDElement struct {
+	ID     string
+	Params []SDParam
+}
+
+// StructuredData the elements of the STRUCTURED-DATA in order
+type StructuredData []SDElement
+
+// Param returns the value of the first param named name
+func (e SDElement) Param(name string) (string, bool) {
+	for _, param := range e.Params {
+		if param.Name == name {
+			return param.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// Values returns the values of every param named name
+func (e SDElement) Values(name string) []string {
+	var values []string
+	for _, param := range e.Params {
+		if param.Name == name {
+			values = append(values, param.Value)
+		}
+	}
+
+	return values
+}
+
+// Element returns the first element with the SD-ID id
+func (sd StructuredData) Element(id string) (SDElement, bool) {
+	for _, element := range sd {
+		if element.ID == id {
+			return element, true
+		}
+	}
+
+	return SDElement{}, false
+}
+
+// Param returns the value of the first param named name of the element id,
+// e.g. sd.Param("exampleSDID@32473", "eventID")
+func (sd StructuredData) Param(id string, name string) (string, bool) {
+	element, ok := sd.Element(id)
+	if !ok {
+		return "", false
+	}
+
+	return element.Param(name)
+}
+
+// ParseStructuredData STRUCTURED-DATA = NILVALUE / 1*SD-ELEMENT, the cursor is
+// moved past it. NILVALUE and the end of the buffer give nil.
+func ParseStructuredData(buff []byte, cursor *int, l int) (StructuredData, error) {
+	var sd StructuredData
+	err := parseStructuredData(buff, cursor, l, &sd, nil)
+
+	return sd, err
+}
+
+// ScanStructuredData checks the STRUCTURED-DATA like ParseStructuredData and
+// moves the cursor past it, without allocating the elements
+func ScanStructuredData(buff []byte, cursor *int, l int) error {
+	return parseStructuredData(buff, cursor, l, nil, nil)
+}
+
+// ValidateStructuredData is ScanStructuredData calling violate with every
+// deviation from the ABNF it tolerates: extra or missing spaces around the
+// params, an unescaped ']' in a value, an SD-ID neither registered nor
+// name@<private enterprise number>, and an SD-ID found more than once
+func ValidateStructuredData(buff []byte, cursor *int, l int, violate Violation) error {
+	return parseStructuredData(buff, cursor, l, nil, violate)
+}
+
+// parseStructuredData appends the elements to sd, when not nil, and reports the
+// deviations to violate, when not nil
+func parseStructuredData(buff []byte, cursor *int, l int, sd *StructuredData, violate Violation) error {
+	if *cursor >= l {
+		return nil
+	}
+
+	if buff[*cursor] == '-' {
+		*cursor++
+		return nil
+	}
+
+	if buff[*cursor] != '[' {
+		return sdError(ErrNoStructuredData, buff, *cursor, `NILVALUE or "["`)
+	}
+
+	// the SD-IDs seen so far, kept on the stack for the usual few elements
+	var seen [8][]byte
+	ids := seen[:0]
+
+	for *cursor < l && buff[*cursor] == '[' {
+		// the SD-ID follows the "["
+		from := *cursor + 1
+
+		id, err := parseSDElement(buff, cursor, l, sd, violate)
+		if err != nil {
+			return err
+		}
+
+		if violate == nil {
+			continue
+		}
+
+		for _, other := range ids {
+			if bytes.Equal(id, other) {
+				if err := violate(sdError(ErrDuplicateSDID, buff, from, "a new SD-ID")); err != nil {
+					return err
+				}
+				break
+			}
+		}
+
+		ids = append(ids, id)
+	}
+
+	if *cursor < l && buff[*cursor] != ' ' {
+		return sdError(ErrNoStructuredData, buff, *cursor, `SP or "["`)
+	}
+
+	return nil
+}
+
+// sdError returns the *ParseError of err found at offset of the structured data
+func sdError(err error, buff []byte, offset int, expected string) *ParseError {
+	return NewParseError(err, "structuredData", buff, offset, expected)
+}
+
+// SD-ELEMENT = "[" SD-ID *(SP SD-PARAM) "]", it returns the SD-ID
+func parseSDElement(buff []byte, cursor *int, l int, sd *StructuredData, violate Violation) ([]byte, error) {
+	var element *SDElement
+
+	// move over "["
+	*cursor++
+
+	from := *cursor
+	id, err := parseSDID(buff, cursor, l)
+	if err != nil {
+		return nil, err
+	}
+
+	if *cursor < l && buff[*cursor] != ' ' && buff[*cursor] != ']' {
+		return nil, sdError(ErrInvalidSDID, buff, *cursor, `SP or "]"`)
+	}
+
+	if violate != nil && !isRegisteredSDID(id) {
+		if err := violate(sdError(ErrInvalidSDID, buff, from, "a registered SD-ID or name@<private enterprise number>")); err != nil {
+			return nil, err
+		}
+	}
+
+	if sd != nil {
+		*sd = append(*sd, SDElement{ID: string(id)})
+		element = &(*sd)[len(*sd)-1]
+	}
+
+	for {
+		// XXX : relaxed, any number of spaces is accepted between the params
+		spaces := *cursor
+		for *cursor < l && buff[*cursor] == ' ' {
+			*cursor++
+		}
+		spaces = *cursor - spaces
+
+		if *cursor >= l {
+			return nil, sdError(ErrNoStructuredData, buff, *cursor, `"]"`)
+		}
+
+		if buff[*cursor] == ']' {
+			if violate != nil && spaces > 0 {
+				if err := violate(sdError(ErrInvalidSDParamName, buff, *cursor-spaces, `"]"`)); err != nil {
+					return nil, err
+				}
+			}
+
+			*cursor++
+			return id, nil
+		}
+
+		if violate != nil && spaces != 1 {
+			// the param right after the previous one, or the first extra space
+			offset := *cursor
+			if spaces > 1 {
+				offset = *cursor - spaces + 1
+			}
+
+			if err := violate(sdError(ErrInvalidSDParamName, buff, offset, "a single SP before SD-PARAM")); err != nil {
+				return nil, err
+			}
+		}
+
+		name, value, err := parseSDParam(buff, cursor, l, violate)
+		if err != nil {
+			return nil, err
+		}
+
+		if element != nil {
+			element.Params = append(element.Params, SDParam{
+				Name:  string(name),
+				Value: unescapeParamValue(value),
+			})
+		}
+	}
+}
+
+// SD-ID = SD-NAME, either an IANA registered name or name@<private enterprise number>
+func parseSDID(buff []byte, cursor *int, l int) ([]byte, error) {
+	from := *cursor
+	id, err := parseSDName(buff, cursor, l, ErrInvalidSDID, "SD-ID")
+	if err != nil {
+		return nil, err
+	}
+
+	at := bytes.IndexByte(id, '@')
+	if at < 0 {
+		return id, nil
+	}
+
+	enterprise := id[at+1:]
+	if at == 0 {
+		return nil, sdError(ErrInvalidSDID, buff, from, "SD-NAME before @")
+	}
+
+	if len(enterprise) == 0 {
+		return nil, sdError(ErrInvalidSDID, buff, from+at+1, "private enterprise number")
+	}
+
+	for i, c := range enterprise {
+		if !IsDigit(c) && c != '.' {
+			return nil, sdError(ErrInvalidSDID, buff, from+at+1+i, "DIGIT or \".\"")
+		}
+	}
+
+	return id, nil
+}
+
+// isRegisteredSDID tells whether id is name@<private enterprise number> or
+// registered with the IANA
+func isRegisteredSDID(id []byte) bool {
+	if bytes.IndexByte(id, '@') >= 0 {
+		return true
+	}
+
+	for _, registered := range registeredSDIDs {
+		if string(id) == registered {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SD-PARAM = PARAM-NAME "=" %d34 PARAM-VALUE %d34, the value is returned escaped
+func parseSDParam(buff []byte, cursor *int, l int, violate Violation) ([]byte, []byte, error) {
+	name, err := parseSDName(buff, cursor, l, ErrInvalidSDParamName, "PARAM-NAME")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if *cursor >= l || buff[*cursor] != '=' {
+		return nil, nil, sdError(ErrInvalidSDParamName, buff, *cursor, `"="`)
+	}
+
+	*cursor++
+
+	// XXX : relaxed, spaces are accepted before the opening quote
+	if violate != nil && *cursor < l && buff[*cursor] == ' ' {
+		if err := violate(sdError(ErrInvalidSDParamValue, buff, *cursor, "%d34")); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for *cursor < l && buff[*cursor] == ' ' {
+		*cursor++
+	}
+
+	if *cursor >= l || buff[*cursor] != '"' {
+		return nil, nil, sdError(ErrInvalidSDParamValue, buff, *cursor, "%d34")
+	}
+
+	*cursor++
+
+	value, err := parseParamValue(buff, cursor, l, violate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return name, value, nil
+}
+
+// SD-NAME = 1*32PRINTUSASCII ; except '=', SP, ']', %d34 (")
+func parseSDName(buff []byte, cursor *int, l int, e error, expected string) ([]byte, error) {
+	from := *cursor
+	to := from
+
+	for to < l && isSDNameChar(buff[to]) {
+		to++
+	}
+
+	if to == from {
+		return nil, sdError(e, buff, from, expected)
+	}
+
+	if to-from > 32 {
+		return nil, sdError(e, buff, from+32, "at most 32 characters of "+expected)
+	}
+
+	*cursor = to
+
+	return buff[from:to], nil
+}
+
+func isSDNameChar(c byte) bool {
+	return c >= 33 && c <= 126 && c != '=' && c != ']' && c != '"'
+}
+
+// PARAM-VALUE = UTF-8-STRING ; characters '"', '\' and ']' MUST be escaped.
+// The value is returned as is, up to the closing quote, an unescaped ']' is
+// tolerated.
+func parseParamValue(buff []byte, cursor *int, l int, violate Violation) ([]byte, error) {
+	from := *cursor
+
+	for to := from; to < l; to++ {
+		c := buff[to]
+
+		if c == '"' {
+			*cursor = to + 1
+			return buff[from:to], nil
+		}
+
+		if c == ']' && violate != nil {
+			if err := violate(sdError(ErrInvalidSDParamValue, buff, to, `escaped "]"`)); err != nil {
+				return nil, err
+			}
+		}
+
+		if c == '\\' && to+1 < l && isSDEscaped(buff[to+1]) {
+			to++
+		}
+	}
+
+	return nil, sdError(ErrInvalidSDParamValue, buff, l, "%d34")
+}
+
+// unescapeParamValue removes the escaping backslashes, a backslash followed by
+// any other character is kept as is
+func unescapeParamValue(value []byte) string {
+	if bytes.IndexByte(value, '\\') < 0 {
+		return string(value)
+	}
+
+	unescaped := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) && isSDEscaped(value[i+1]) {
+			i++
+		}
+
+		unescaped = append(unescaped, value[i])
+	}
+
+	return string(unescaped)
+}
+
+func isSDEscaped(c byte) bool {
+	return c == '"' || c == '\\' || c == ']'
+}
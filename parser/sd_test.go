@@ -0,0 +1,188 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hooks up gocheck into the gotest runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type SDTestSuite struct {
+}
+
+var _ = Suite(&SDTestSuite{})
+
+func (s *SDTestSuite) TestParseStructuredData(c *C) {
+	fixtures := []struct {
+		sd       string
+		expected StructuredData
+		cursor   int
+	}{
+		{"-", nil, 1},
+		{"", nil, 0},
+		{"[exampleSDID@32473]", StructuredData{{ID: "exampleSDID@32473"}}, 19},
+		{
+			`[exampleSDID@32473 iut="3" eventSource="Application"] msg`,
+			StructuredData{{ID: "exampleSDID@32473", Params: []SDParam{
+				{Name: "iut", Value: "3"},
+				{Name: "eventSource", Value: "Application"},
+			}}},
+			53,
+		},
+		{
+			// '"', '\' and ']' are escaped, a backslash before any other character is kept
+			`[meta value="a\"b\\c\]d\e"]`,
+			StructuredData{{ID: "meta", Params: []SDParam{{Name: "value", Value: `a"b\c]d\e`}}}},
+			27,
+		},
+		{
+			`[origin ip="192.0.2.1" ip="192.0.2.2"][meta sequenceId="1"]`,
+			StructuredData{
+				{ID: "origin", Params: []SDParam{{Name: "ip", Value: "192.0.2.1"}, {Name: "ip", Value: "192.0.2.2"}}},
+				{ID: "meta", Params: []SDParam{{Name: "sequenceId", Value: "1"}}},
+			},
+			59,
+		},
+		{
+			// the duplicate SD-IDs are only reported by ValidateStructuredData
+			`[meta a="1"][meta a="2"]`,
+			StructuredData{
+				{ID: "meta", Params: []SDParam{{Name: "a", Value: "1"}}},
+				{ID: "meta", Params: []SDParam{{Name: "a", Value: "2"}}},
+			},
+			24,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		cursor := 0
+		sd, err := ParseStructuredData([]byte(fixture.sd), &cursor, len(fixture.sd))
+
+		comment := Commentf("sd %s", fixture.sd)
+		c.Assert(err, IsNil, comment)
+		c.Assert(sd, DeepEquals, fixture.expected, comment)
+		c.Assert(cursor, Equals, fixture.cursor, comment)
+
+		cursor = 0
+		c.Assert(ScanStructuredData([]byte(fixture.sd), &cursor, len(fixture.sd)), IsNil, comment)
+		c.Assert(cursor, Equals, fixture.cursor, comment)
+	}
+}
+
+func (s *SDTestSuite) TestParseStructuredData_Invalid(c *C) {
+	fixtures := []struct {
+		sd     string
+		err    error
+		offset int
+	}{
+		{"x", ErrNoStructuredData, 0},
+		{"[]", ErrInvalidSDID, 1},
+		{"[@32473]", ErrInvalidSDID, 1},
+		{"[id@]", ErrInvalidSDID, 4},
+		{"[id@32x73]", ErrInvalidSDID, 6},
+		{"[abcdefghijklmnopqrstuvwxyz0123456789]", ErrInvalidSDID, 33},
+		{`[id"x]`, ErrInvalidSDID, 3},
+		{`[meta ="1"]`, ErrInvalidSDParamName, 6},
+		{`[meta a]`, ErrInvalidSDParamName, 7},
+		{`[meta a=1]`, ErrInvalidSDParamValue, 8},
+		{`[meta a="1]`, ErrInvalidSDParamValue, 11},
+		{`[meta a="1\"]`, ErrInvalidSDParamValue, 13},
+		{`[meta a="1"`, ErrNoStructuredData, 11},
+		{`[meta a="1"]x`, ErrNoStructuredData, 12},
+	}
+
+	for _, fixture := range fixtures {
+		cursor := 0
+		_, err := ParseStructuredData([]byte(fixture.sd), &cursor, len(fixture.sd))
+
+		comment := Commentf("sd %s", fixture.sd)
+		c.Assert(errors.Is(err, fixture.err), Equals, true, comment)
+
+		var parseErr *ParseError
+		c.Assert(errors.As(err, &parseErr), Equals, true, comment)
+		c.Assert(parseErr.Field, Equals, "structuredData", comment)
+		c.Assert(parseErr.Offset, Equals, fixture.offset, comment)
+	}
+}
+
+func (s *SDTestSuite) TestValidateStructuredData(c *C) {
+	fixtures := []struct {
+		sd         string
+		violations []error
+		offsets    []int
+	}{
+		{`[exampleSDID@32473 a="1"][meta b="2"]`, nil, nil},
+		{`[custom a="1"]`, []error{ErrInvalidSDID}, []int{1}},
+		{`[meta a="1"][meta a="2"]`, []error{ErrDuplicateSDID}, []int{13}},
+		{`[meta  a="1"]`, []error{ErrInvalidSDParamName}, []int{6}},
+		{`[meta a="1"b="2"]`, []error{ErrInvalidSDParamName}, []int{11}},
+		{`[meta a="1" ]`, []error{ErrInvalidSDParamName}, []int{11}},
+		{`[meta a= "1"]`, []error{ErrInvalidSDParamValue}, []int{8}},
+		{`[meta a="1]"]`, []error{ErrInvalidSDParamValue}, []int{10}},
+	}
+
+	for _, fixture := range fixtures {
+		var violations []error
+		var offsets []int
+		violate := func(err *ParseError) error {
+			violations = append(violations, err.Err)
+			offsets = append(offsets, err.Offset)
+			return nil
+		}
+
+		cursor := 0
+		err := ValidateStructuredData([]byte(fixture.sd), &cursor, len(fixture.sd), violate)
+
+		comment := Commentf("sd %s", fixture.sd)
+		c.Assert(err, IsNil, comment)
+		c.Assert(violations, DeepEquals, fixture.violations, comment)
+		c.Assert(offsets, DeepEquals, fixture.offsets, comment)
+		c.Assert(cursor, Equals, len(fixture.sd), comment)
+	}
+
+	// a violation returning an error stops the parsing with it
+	cursor := 0
+	sd := `[meta a="1"][meta a="2"]`
+	err := ValidateStructuredData([]byte(sd), &cursor, len(sd), func(err *ParseError) error {
+		return err
+	})
+	c.Assert(errors.Is(err, ErrDuplicateSDID), Equals, true)
+}
+
+func (s *SDTestSuite) TestAccessors(c *C) {
+	sd := StructuredData{
+		{ID: "origin", Params: []SDParam{{Name: "ip", Value: "192.0.2.1"}, {Name: "ip", Value: "192.0.2.2"}}},
+		{ID: "exampleSDID@32473", Params: []SDParam{{Name: "eventID", Value: "1011"}}},
+		{ID: "origin", Params: []SDParam{{Name: "ip", Value: "192.0.2.3"}}},
+	}
+
+	element, ok := sd.Element("origin")
+	c.Assert(ok, Equals, true)
+	c.Assert(element, DeepEquals, sd[0])
+
+	_, ok = sd.Element("meta")
+	c.Assert(ok, Equals, false)
+
+	value, ok := element.Param("ip")
+	c.Assert(ok, Equals, true)
+	c.Assert(value, Equals, "192.0.2.1")
+
+	_, ok = element.Param("software")
+	c.Assert(ok, Equals, false)
+
+	c.Assert(element.Values("ip"), DeepEquals, []string{"192.0.2.1", "192.0.2.2"})
+	c.Assert(element.Values("software"), IsNil)
+
+	value, ok = sd.Param("exampleSDID@32473", "eventID")
+	c.Assert(ok, Equals, true)
+	c.Assert(value, Equals, "1011")
+
+	_, ok = sd.Param("meta", "eventID")
+	c.Assert(ok, Equals, false)
+
+	_, ok = sd.Param("exampleSDID@32473", "iut")
+	c.Assert(ok, Equals, false)
+}
@@ -0,0 +1,65 @@
+//go:build linux
+
+package gsyslog
+
+import (
+	"github.com/crazy-airhead/gsyslog/parser"
+	"golang.org/x/sys/unix"
+	"net"
+)
+
+// credOOBSize is the size of the ancillary data holding SCM_CREDENTIALS
+var credOOBSize = unix.CmsgSpace(unix.SizeofUcred)
+
+// peerCred returns the credentials of the process connected to a unix stream socket
+func peerCred(fd int) *parser.Credential {
+	ucred, err := unix.GetsockoptUcred(fd, unix.SOL_SOCKET, unix.SO_PEERCRED)
+	if err != nil {
+		return nil
+	}
+
+	return newCredential(ucred)
+}
+
+// enablePassCred asks the kernel to attach SCM_CREDENTIALS to every datagram
+func enablePassCred(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PASSCRED, 1)
+	})
+	if err != nil {
+		return err
+	}
+
+	return sockErr
+}
+
+// parseCred returns the SCM_CREDENTIALS found in the ancillary data of a datagram
+func parseCred(oob []byte) *parser.Credential {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+
+	for i := range msgs {
+		ucred, err := unix.ParseUnixCredentials(&msgs[i])
+		if err == nil {
+			return newCredential(ucred)
+		}
+	}
+
+	return nil
+}
+
+func newCredential(ucred *unix.Ucred) *parser.Credential {
+	return &parser.Credential{
+		Pid: int(ucred.Pid),
+		Uid: int(ucred.Uid),
+		Gid: int(ucred.Gid),
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package gsyslog
+
+import (
+	"github.com/crazy-airhead/gsyslog/parser"
+	"net"
+)
+
+// credOOBSize peer credentials are only supported on linux
+var credOOBSize = 0
+
+func peerCred(fd int) *parser.Credential {
+	return nil
+}
+
+func enablePassCred(conn *net.UnixConn) error {
+	return nil
+}
+
+func parseCred(oob []byte) *parser.Credential {
+	return nil
+}
@@ -0,0 +1,38 @@
+package gsyslog
+
+import "sync"
+
+// bufferPool holds the buffers the datagrams are copied to when logs are pooled
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new([]byte)
+	},
+}
+
+// copyDatagram copies data, which the transport reuses, for the task. The copy
+// comes from bufferPool when logs are pooled and goes back there once the task
+// is done, see release.
+func (s *Server) copyDatagram(data []byte) ([]byte, *[]byte) {
+	if !s.pooling {
+		copyData := make([]byte, len(data))
+		copy(copyData, data)
+
+		return copyData, nil
+	}
+
+	buf := bufferPool.Get().(*[]byte)
+	*buf = append((*buf)[:0], data...)
+
+	return *buf, buf
+}
+
+// release puts the buffer of t back to the pool
+func (s *Server) release(t *task) {
+	if t == nil || t.buf == nil {
+		return
+	}
+
+	bufferPool.Put(t.buf)
+	t.buf = nil
+	t.data = nil
+}
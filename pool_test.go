@@ -0,0 +1,132 @@
+package gsyslog
+
+import (
+	"context"
+	"fmt"
+	"github.com/crazy-airhead/gsyslog/parser"
+	"sync"
+	"testing"
+)
+
+// cloneHandler keeps a clone of every log
+type cloneHandler struct {
+	mu   sync.Mutex
+	logs []*parser.Log
+}
+
+func (h *cloneHandler) Handle(log *parser.Log) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.logs = append(h.logs, log.Clone())
+}
+
+func Test_log_pooling(t *testing.T) {
+	handler := &cloneHandler{}
+	server := NewServer()
+	server.SetHandler(handler)
+	server.SetCodec(RFC5424Codec)
+	server.SetLogPooling(true)
+	server.SetOrdering(OrderPerSource)
+
+	l := NewListener("udp://127.0.0.1:0")
+	server.AddListener(l)
+
+	const messages = 100
+	for i := 0; i < messages; i++ {
+		data, buf := server.copyDatagram([]byte(fmt.Sprintf("<165>1 - host app - - [id@1 n=\"%d\"] message %d", i, i)))
+		server.dispatch(&task{listener: l, data: data, client: "127.0.0.1:40000", buf: buf})
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handler.logs) != messages {
+		t.Fatalf("unexpected %d logs", len(handler.logs))
+	}
+
+	// the clones own their data while the buffers were reused
+	for i, log := range handler.logs {
+		if log.GetString("message") != fmt.Sprintf("message %d", i) {
+			t.Fatalf("unexpected message %q", log.GetString("message"))
+		}
+
+		if n, _ := log.SDParam("id@1", "n"); n != fmt.Sprint(i) {
+			t.Fatalf("unexpected param %q", n)
+		}
+
+		if *log.Syslog.Hostname != "host" || log.Header["appName"] != "app" {
+			t.Fatalf("unexpected log %+v", log.Header)
+		}
+	}
+}
+
+// typedHandler reads the typed view of every log, lazy tells whether it is a
+// LazyHandler
+type typedHandler struct {
+	lazy      bool
+	mu        sync.Mutex
+	hostnames []*string
+	tags      []string
+	messages  []string
+}
+
+func (h *typedHandler) Lazy() bool {
+	return h.lazy
+}
+
+func (h *typedHandler) Handle(log *parser.Log) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var hostname *string
+	if log.Syslog.Hostname != nil {
+		name := *log.Syslog.Hostname
+		hostname = &name
+	}
+
+	h.hostnames = append(h.hostnames, hostname)
+	h.tags = append(h.tags, log.Syslog.Tag)
+	h.messages = append(h.messages, log.Syslog.Message)
+}
+
+func Test_log_pooling_typed(t *testing.T) {
+	for _, lazy := range []bool{false, true} {
+		handler := &typedHandler{lazy: lazy}
+		server := NewServer()
+		server.SetHandler(handler)
+		server.SetCodec(RFC3164Codec)
+		server.SetLogPooling(true)
+		server.SetOrdering(OrderPerSource)
+
+		l := NewListener("udp://127.0.0.1:0")
+		server.AddListener(l)
+
+		data, buf := server.copyDatagram([]byte("<34>Oct 11 22:14:15 mymachine su: 'su root' failed"))
+		server.dispatch(&task{listener: l, data: data, client: "127.0.0.1:40000", buf: buf})
+
+		if err := server.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(handler.hostnames) != 1 {
+			t.Fatalf("unexpected %d logs", len(handler.hostnames))
+		}
+
+		if lazy {
+			// a lazy handler reads the raw fields itself
+			if handler.hostnames[0] != nil || handler.tags[0] != "" || handler.messages[0] != "" {
+				t.Fatalf("lazy log materialized %+v", handler)
+			}
+
+			continue
+		}
+
+		// the pooled log is materialized for a handler reading the typed view
+		if handler.hostnames[0] == nil || *handler.hostnames[0] != "mymachine" ||
+			handler.tags[0] != "su" || handler.messages[0] != "'su root' failed" {
+			t.Fatalf("unexpected typed view %+v %v %v", handler.hostnames, handler.tags, handler.messages)
+		}
+	}
+}
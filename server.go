@@ -2,11 +2,14 @@ package gsyslog
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"github.com/crazy-airhead/gsyslog/codec"
-	"github.com/panjf2000/gnet/v2"
-	"github.com/panjf2000/gnet/v2/pkg/logging"
 	"github.com/panjf2000/gnet/v2/pkg/pool/goroutine"
-	"strings"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -14,36 +17,65 @@ var (
 	RFC5424Codec   = &codec.RFC5424Codec{}   // RFC5424: http://www.ietf.org/rfc/rfc5424.txt
 	RFC6587Codec   = &codec.RFC6587Codec{}   // RFC6587: http://www.ietf.org/rfc/rfc6587.txt - octet counting variant
 	AutomaticCodec = &codec.AutomaticCodec{} // Automatically identify the codec
+
+	NonTransparentCodec = &codec.NonTransparentCodec{} // RFC6587: http://www.ietf.org/rfc/rfc6587.txt - non-transparent framing variant
+
+	ErrNoListener      = errors.New("no listener configured")
+	ErrListenerStopped = errors.New("listener stopped")
+	ErrServerStarted   = errors.New("server already started")
+	ErrServerClosed    = errors.New("server closed")
 )
 
 type Server struct {
-	gnet.BuiltinEventEngine
-	eng     gnet.Engine
-	addr    string
-	network string
+	// listener configured through SetAddr, SetTLSConfig, ...
+	listener  *Listener
+	listeners []*Listener
 
 	bufferSize int
 	workerPool *goroutine.Pool
+	pooling    bool
 
 	codec   codec.Codec
 	handler Handler
+
+	ready       chan struct{}
+	closing     chan struct{}
+	closeOnce   sync.Once
+	releaseOnce sync.Once
+	started     atomic.Bool
+	accounting  accounting
+	overflow    overflow
+	ordered     ordered
+	charsets    charsets
+	timezones   timezones
+	// connIDs numbers the stream connections
+	connIDs atomic.Uint64
 }
 
 // NewServer returns a new Server
 func NewServer() *Server {
-	return &Server{
+	s := &Server{
 		handler:    NewDefaultHandler(),
 		codec:      AutomaticCodec,
 		workerPool: goroutine.Default(),
+		ready:      make(chan struct{}),
+		closing:    make(chan struct{}),
 	}
+	s.listener = &Listener{server: s}
+	s.overflow.server = s
+	s.ordered.server = s
+
+	return s
 }
 
 // SetHandler Sets the handler, this handler with receive every syslog entry
+// of the listeners without their own handler
 func (s *Server) SetHandler(handler Handler) {
 	s.handler = handler
 }
 
-// SetCodec Sets the syslog codec (RFC3164 or RFC5424 or RFC6587)
+// SetCodec Sets the syslog codec (RFC3164 or RFC5424 or RFC6587) of the
+// listeners without their own codec
 func (s *Server) SetCodec(f codec.Codec) {
 	s.codec = f
 }
@@ -53,108 +85,171 @@ func (s *Server) SetBufferSize(i int) {
 	s.bufferSize = i
 }
 
-// SetBufferSize Sets the maximum buffer size
+// SetLogPooling Sets whether the logs handed to the handlers are pooled. A
+// pooled Log is parsed without allocating and reused once Handle returns, see
+// Handler and parser.AcquireLog.
+func (s *Server) SetLogPooling(enabled bool) {
+	s.pooling = enabled
+}
+
+// SetWorkerPool Sets the worker pool the messages are parsed and handled on
+func (s *Server) SetWorkerPool(pool *goroutine.Pool) {
+	s.workerPool = pool
+}
+
+// SetAddr Sets the listen address, see Listener.SetAddr
 func (s *Server) SetAddr(addr string) {
-	if strings.HasPrefix(addr, "udp://") {
-		s.network = "udp"
-		s.addr = addr
-	} else if strings.HasPrefix(addr, "tcp://") {
-		s.network = "tcp"
-		s.addr = addr
-	} else if strings.HasPrefix(addr, "unix://") {
-		s.network = "tcp"
-		s.addr = addr
-	}
+	s.listener.SetAddr(addr)
 }
 
-func (s *Server) Boot() error {
-	err := gnet.Run(s, s.addr,
-		gnet.WithMulticore(true),
-		gnet.WithSocketRecvBuffer(s.bufferSize))
-	if err != nil {
-		return err
-	}
+// SetTLSConfig Sets the TLS config used by the tls:// address, see Listener.SetTLSConfig
+func (s *Server) SetTLSConfig(config *tls.Config) {
+	s.listener.SetTLSConfig(config)
+}
 
-	return nil
+// SetTLSHandshakeTimeout Sets how long a client of the tls:// address has to
+// complete the handshake, see Listener.SetTLSHandshakeTimeout
+func (s *Server) SetTLSHandshakeTimeout(timeout time.Duration) {
+	s.listener.SetTLSHandshakeTimeout(timeout)
 }
 
-func (s *Server) Stop() error {
-	_ = s.eng.Stop(context.Background())
-	s.workerPool.Release()
+// SetUnixSocketMode Sets the permissions of the unix socket file, see Listener.SetUnixSocketMode
+func (s *Server) SetUnixSocketMode(mode os.FileMode) {
+	s.listener.SetUnixSocketMode(mode)
+}
 
-	return nil
+// SetUnixSocketOwner Sets the owner of the unix socket file, see Listener.SetUnixSocketOwner
+func (s *Server) SetUnixSocketOwner(uid int, gid int) {
+	s.listener.SetUnixSocketOwner(uid, gid)
 }
 
-func (s *Server) OnBoot(eng gnet.Engine) gnet.Action {
-	s.eng = eng
+// AddListener Adds a listener, all the listeners are served together by Serve
+// and stopped together by Shutdown
+func (s *Server) AddListener(l *Listener) {
+	l.server = s
+	s.listeners = append(s.listeners, l)
+}
 
-	logging.Infof("syslog server is listening on %s\n", s.addr)
+// Listeners returns every listener of the server
+func (s *Server) Listeners() []*Listener {
+	if s.listener.addr == "" {
+		return s.listeners
+	}
 
-	return gnet.None
+	return append([]*Listener{s.listener}, s.listeners...)
 }
 
-func (s *Server) OnTraffic(conn gnet.Conn) (action gnet.Action) {
-	if s.network == "udp" {
-		return s.handleUdp(conn)
+func (s *Server) listenerByName(name string) *Listener {
+	for _, l := range s.Listeners() {
+		if l.Name() == name {
+			return l
+		}
 	}
 
-	if s.network == "tcp" {
-		return s.handleTcp(conn)
+	return nil
+}
+
+// Serve binds every listener and returns once they all accept traffic, the
+// listeners are then served in the background until Shutdown is called or ctx
+// is done. When a listener can not be bound, the ones already bound are stopped
+// and its error is returned. A server is served once, ErrServerStarted is
+// returned when it is already served and ErrServerClosed once it is shut down.
+func (s *Server) Serve(ctx context.Context) error {
+	listeners := s.Listeners()
+	if len(listeners) == 0 {
+		return ErrNoListener
 	}
 
-	if s.network == "unix" {
-		return s.handleUdp(conn)
+	select {
+	case <-s.closing:
+		return ErrServerClosed
+	default:
 	}
 
-	return gnet.None
-}
+	if !s.started.CompareAndSwap(false, true) {
+		return ErrServerStarted
+	}
 
-func (s *Server) handleUdp(conn gnet.Conn) (action gnet.Action) {
-	data, err := conn.Next(-1)
-	if err != nil {
-		logging.Errorf("syslog read buff, something wrong, error:%v", err)
-		return gnet.None
+	for i, l := range listeners {
+		l.server = s
+		if err := l.bind(ctx); err != nil {
+			for _, bound := range listeners[:i] {
+				_ = bound.stop(context.Background())
+			}
+
+			// nothing is served, it may be served again
+			s.started.Store(false)
+			return err
+		}
 	}
 
-	client := conn.RemoteAddr().String()
-	copyData := make([]byte, len(data))
-	copy(copyData, data)
-	_ = s.workerPool.Submit(func() {
-		s.parser(copyData, client)
-	})
+	close(s.ready)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = s.Shutdown(context.Background())
+		case <-s.closing:
+		}
+	}()
 
-	return gnet.None
+	return nil
 }
 
-func (s *Server) handleTcp(conn gnet.Conn) (action gnet.Action) {
-	for {
-		data, err := s.codec.Decode(conn)
-		if err != nil {
-			break
-		}
+// Ready returns a channel closed once every listener accepts traffic
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
 
-		client := conn.RemoteAddr().String()
-		_ = s.workerPool.Submit(func() {
-			s.parser(data, client)
-		})
+// Boot serves every listener, it blocks until they are all stopped and returns
+// the first error of the listeners, if any
+func (s *Server) Boot() error {
+	err := s.Serve(context.Background())
+	if err != nil {
+		return err
+	}
 
-		return gnet.None
+	for _, l := range s.Listeners() {
+		if e := l.wait(); e != nil && err == nil {
+			err = e
+		}
 	}
 
-	if conn.InboundBuffered() > 0 {
-		if err := conn.Wake(nil); err != nil { // wake up the connection manually to avoid missing the leftover data
-			logging.Errorf("failed to wake up the connection, %v", err)
-			return gnet.Close
+	return err
+}
+
+// Shutdown stops accepting traffic on every listener, then waits for every
+// message already received to be handled or dropped, see Stats. It returns
+// ctx.Err() when ctx is done first.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+	})
+
+	for _, l := range s.Listeners() {
+		if err := l.stop(ctx); err != nil {
+			return err
 		}
 	}
 
-	return gnet.None
+	if err := s.accounting.wait(ctx); err != nil {
+		return err
+	}
+
+	s.releaseOnce.Do(func() {
+		s.ordered.stop()
+		s.workerPool.Release()
+	})
 
+	return nil
 }
 
-func (s *Server) parser(line []byte, client string) {
-	parser := s.codec.GetParser(line)
-	log, _ := parser.Parse(line, client)
+// Stats returns the message counters of the server
+func (s *Server) Stats() Stats {
+	return s.accounting.stats()
+}
 
-	s.handler.Handle(log)
+// Stop is Shutdown without deadline
+func (s *Server) Stop() error {
+	return s.Shutdown(context.Background())
 }
@@ -1,27 +1,427 @@
 package gsyslog
 
 import (
+	"context"
+	"fmt"
+	"github.com/crazy-airhead/gsyslog/parser"
+	"net"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func Test_udp_server(t *testing.T) {
 	server := NewServer()
 	server.SetCodec(RFC3164Codec)
-	server.SetAddr("udp://0.0.0.0:514")
+	server.SetAddr("udp://127.0.0.1:10514")
 	defer func(server *Server) {
 		_ = server.Stop()
 	}(server)
 
-	_ = server.Boot()
+	if err := server.Serve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func Test_tcp_server(t *testing.T) {
 	server := NewServer()
 	server.SetCodec(RFC3164Codec)
-	server.SetAddr("tcp://0.0.0.0:514")
+	server.SetAddr("tcp://127.0.0.1:10514")
 	defer func(server *Server) {
 		_ = server.Stop()
 	}(server)
 
-	_ = server.Boot()
+	if err := server.Serve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// slowHandler blocks every log until release is closed
+type slowHandler struct {
+	received chan *parser.Log
+	release  chan struct{}
+	handled  int64
+}
+
+func (h *slowHandler) Handle(log *parser.Log) {
+	h.received <- log
+	<-h.release
+	atomic.AddInt64(&h.handled, 1)
+}
+
+func Test_server_lifecycle(t *testing.T) {
+	handler := &slowHandler{received: make(chan *parser.Log, 10), release: make(chan struct{})}
+	server := NewServer()
+	server.SetHandler(handler)
+	server.SetAddr("tcp://127.0.0.1:10515")
+
+	select {
+	case <-server.Ready():
+		t.Fatal("ready before Serve")
+	default:
+	}
+
+	if err := server.Serve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-server.Ready():
+	default:
+		t.Fatal("not ready after Serve")
+	}
+
+	// bound synchronously, no need to retry
+	conn, err := net.Dial("tcp", "127.0.0.1:10515")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = conn.Write([]byte("<34>Oct 11 22:14:15 mymachine su: a\n<34>Oct 11 22:14:15 mymachine su: b\n"))
+	<-handler.received
+	<-handler.received
+	_ = conn.Close()
+
+	// handlers are still running, the deadline is hit
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err = server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	close(handler.release)
+	if err = server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if handled := atomic.LoadInt64(&handler.handled); handled != 2 {
+		t.Fatalf("shutdown returned with %d handled logs", handled)
+	}
+
+	if stats := server.Stats(); stats != (Stats{Received: 2, Handled: 2}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	if _, err = net.Dial("tcp", "127.0.0.1:10515"); err == nil {
+		t.Fatal("still accepting after shutdown")
+	}
+}
+
+func Test_server_serve_twice(t *testing.T) {
+	server := NewServer()
+	server.SetAddr("udp://127.0.0.1:0")
+
+	if err := server.Serve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Serve(context.Background()); err != ErrServerStarted {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Serve(context.Background()); err != ErrServerClosed {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// shut down before being served
+	server = NewServer()
+	server.SetAddr("udp://127.0.0.1:0")
+	_ = server.Stop()
+
+	if err := server.Serve(context.Background()); err != ErrServerClosed {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func Test_server_bind_error(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:10516")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	server := NewServer()
+	server.AddListener(NewListener("udp://127.0.0.1:10516"))
+	server.AddListener(NewListener("tcp://127.0.0.1:10516"))
+
+	if err = server.Serve(context.Background()); err == nil {
+		t.Fatal("expected a bind error")
+	}
+
+	// the udp listener bound first has been stopped
+	conn, err := net.ListenPacket("udp", "127.0.0.1:10516")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+}
+
+func Test_server_context_cancel(t *testing.T) {
+	server := NewServer()
+	server.SetAddr("tcp://127.0.0.1:10517")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := server.Serve(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	var err error
+	for i := 0; i < 50 && err == nil; i++ {
+		var conn net.Conn
+		if conn, err = net.Dial("tcp", "127.0.0.1:10517"); err == nil {
+			_ = conn.Close()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	if err == nil {
+		t.Fatal("still accepting after the context is done")
+	}
+}
+
+func Test_multiple_listeners(t *testing.T) {
+	udpHandler := make(chanHandler, 50)
+	tcpHandler := make(chanHandler, 1)
+	defaultHandler := make(chanHandler, 1)
+
+	server := NewServer()
+	server.SetHandler(defaultHandler)
+
+	udp := NewListener("udp://127.0.0.1:15514")
+	udp.SetCodec(RFC3164Codec)
+	udp.SetHandler(udpHandler)
+	server.AddListener(udp)
+
+	tcp := NewListener("tcp://127.0.0.1:15601")
+	tcp.SetCodec(RFC6587Codec)
+	tcp.SetHandler(tcpHandler)
+	server.AddListener(tcp)
+
+	// no handler nor codec, uses the ones of the server
+	server.AddListener(NewListener("tcp://127.0.0.1:15602"))
+
+	booted := make(chan error, 1)
+	go func() {
+		booted <- server.Boot()
+	}()
+
+	// datagrams sent before the listener is bound are lost, send until received
+	conn := dialRetry(t, "udp", "127.0.0.1:15514")
+	var log *parser.Log
+	for i := 0; i < 50 && log == nil; i++ {
+		_, _ = conn.Write([]byte("<34>Oct 11 22:14:15 mymachine su: udp"))
+		select {
+		case log = <-udpHandler:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	if log == nil || log.GetString("content") != "udp" {
+		t.Fatalf("unexpected log %v", log)
+	}
+	_ = conn.Close()
+
+	conn = dialRetry(t, "tcp", "127.0.0.1:15601")
+	msg := "<165>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - tcp"
+	_, _ = conn.Write([]byte(fmt.Sprintf("%d %s", len(msg), msg)))
+	if got := waitLog(t, tcpHandler).GetString("message"); got != "tcp" {
+		t.Fatalf("unexpected message %q", got)
+	}
+	_ = conn.Close()
+
+	conn = dialRetry(t, "tcp", "127.0.0.1:15602")
+	_, _ = conn.Write([]byte("<34>Oct 11 22:14:15 mymachine su: default\n"))
+	if got := waitLog(t, defaultHandler).GetString("content"); got != "default" {
+		t.Fatalf("unexpected content %q", got)
+	}
+	_ = conn.Close()
+
+	_ = server.Stop()
+	select {
+	case err := <-booted:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Boot did not return after Stop")
+	}
+}
+
+func Test_envelope(t *testing.T) {
+	handler := make(chanHandler, 50)
+
+	server := NewServer()
+	server.SetHandler(handler)
+
+	udp := NewListener("udp://127.0.0.1:15515")
+	udp.SetName("udp")
+	server.AddListener(udp)
+	server.AddListener(NewListener("tcp://127.0.0.1:15604"))
+
+	booted := make(chan error, 1)
+	go func() {
+		booted <- server.Boot()
+	}()
+
+	start := time.Now()
+	body := "<34>Oct 11 22:14:15 mymachine su: udp"
+	conn := dialRetry(t, "udp", "127.0.0.1:15515")
+	var log *parser.Log
+	for i := 0; i < 50 && log == nil; i++ {
+		_, _ = conn.Write([]byte(body))
+		select {
+		case log = <-handler:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	if log == nil {
+		t.Fatal("no log received")
+	}
+
+	local := conn.LocalAddr().(*net.UDPAddr).AddrPort()
+	expected := parser.Envelope{
+		ReceivedAt: log.Envelope.ReceivedAt,
+		Listener:   "udp",
+		Transport:  "udp",
+		LocalAddr:  "127.0.0.1:15515",
+		RemoteAddr: local,
+		FrameLen:   len(body),
+	}
+	if log.Envelope != expected || log.Envelope.ReceivedAt.Before(start) {
+		t.Fatalf("unexpected envelope %+v", log.Envelope)
+	}
+	_ = conn.Close()
+
+	// the RFC5424 logs have a source too
+	body = "<165>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - tcp"
+	conn = dialRetry(t, "tcp", "127.0.0.1:15604")
+	_, _ = conn.Write([]byte(body + "\n"))
+	log = waitLog(t, handler)
+
+	local = conn.LocalAddr().(*net.TCPAddr).AddrPort()
+	if log.Syslog.Client != local.String() {
+		t.Fatalf("unexpected client %q", log.Syslog.Client)
+	}
+
+	envelope := log.Envelope
+	if envelope.Listener != "tcp://127.0.0.1:15604" || envelope.Transport != "tcp" ||
+		envelope.LocalAddr != "127.0.0.1:15604" || envelope.RemoteAddr != local ||
+		envelope.ConnID == 0 || envelope.FrameLen != len(body) || envelope.ReceivedAt.Before(start) {
+		t.Fatalf("unexpected envelope %+v", envelope)
+	}
+	_ = conn.Close()
+
+	_ = server.Stop()
+	select {
+	case err := <-booted:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Boot did not return after Stop")
+	}
+}
+
+func Test_multiple_listeners_bind_error(t *testing.T) {
+	server := NewServer()
+	server.AddListener(NewListener("tcp://127.0.0.1:15603"))
+	server.AddListener(NewListener("tcp://127.0.0.1:15603"))
+
+	booted := make(chan error, 1)
+	go func() {
+		booted <- server.Boot()
+	}()
+
+	select {
+	case err := <-booted:
+		if err == nil {
+			t.Fatal("expected a bind error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Boot did not return on bind error")
+	}
+}
+
+// panicHandler panics on logs with a "panic" content
+type panicHandler struct {
+}
+
+func (h *panicHandler) Handle(log *parser.Log) {
+	if log.GetString("content") == "panic" {
+		panic("handler failure")
+	}
+}
+
+func Test_server_stats(t *testing.T) {
+	server := NewServer()
+	server.SetHandler(&panicHandler{})
+	server.SetAddr("tcp://127.0.0.1:10519")
+
+	if err := server.Serve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:10519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		_, _ = conn.Write([]byte("<34>Oct 11 22:14:15 mymachine su: hello\n"))
+	}
+	_, _ = conn.Write([]byte("<34>Oct 11 22:14:15 mymachine su: panic\n"))
+	_ = conn.Close()
+
+	// wait for the server to read everything before shutting down
+	for i := 0; i < 100 && server.Stats().Received < 101; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err = server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Stats{Received: 101, Handled: 100, Dropped: 1, DroppedHandlerPanic: 1}
+	if stats := server.Stats(); stats != expected {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func Test_server_stats_ordered(t *testing.T) {
+	server := NewServer()
+	server.SetHandler(&panicHandler{})
+	server.SetOrdering(OrderPerConnection)
+	server.SetOrderedShards(1)
+	server.SetAddr("tcp://127.0.0.1:10520")
+
+	if err := server.Serve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:10520")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the shard keeps serving after the panic
+	for i := 0; i < 100; i++ {
+		if i == 50 {
+			_, _ = conn.Write([]byte("<34>Oct 11 22:14:15 mymachine su: panic\n"))
+		}
+		_, _ = conn.Write([]byte("<34>Oct 11 22:14:15 mymachine su: hello\n"))
+	}
+	_ = conn.Close()
+
+	for i := 0; i < 100 && server.Stats().Received < 101; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err = server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Stats{Received: 101, Handled: 100, Dropped: 1, DroppedHandlerPanic: 1}
+	if stats := server.Stats(); stats != expected {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
 }
@@ -0,0 +1,136 @@
+package gsyslog
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// sources maps the sources of the logs to values, a source being an IP or a
+// CIDR, the longest prefix matching the address of a log winning, or a
+// hostname. It may be set while logs are looked up.
+type sources[T any] struct {
+	mu sync.RWMutex
+	// prefixes the longest first
+	prefixes []sourcePrefix[T]
+	// hostnames by their lower case names
+	hostnames map[string]T
+}
+
+type sourcePrefix[T any] struct {
+	prefix netip.Prefix
+	value  T
+}
+
+// parseSource parses source, an IP or a CIDR, e.g. 192.0.2.1 or 192.0.2.0/24
+func parseSource(source string) (netip.Prefix, error) {
+	if strings.Contains(source, "/") {
+		prefix, err := netip.ParsePrefix(source)
+		if err != nil {
+			return prefix, err
+		}
+
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(source)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// set maps source to value, replacing the value of the same source
+func (s *sources[T]) set(source string, value T) error {
+	prefix, err := parseSource(source)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.prefixes {
+		if s.prefixes[i].prefix == prefix {
+			s.prefixes[i].value = value
+			return nil
+		}
+	}
+
+	s.prefixes = append(s.prefixes, sourcePrefix[T]{prefix: prefix, value: value})
+	sort.SliceStable(s.prefixes, func(i, j int) bool {
+		return s.prefixes[i].prefix.Bits() > s.prefixes[j].prefix.Bits()
+	})
+
+	return nil
+}
+
+// setHostname maps the logs of hostname to value, the case is ignored
+func (s *sources[T]) setHostname(hostname string, value T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hostnames == nil {
+		s.hostnames = make(map[string]T)
+	}
+
+	s.hostnames[strings.ToLower(hostname)] = value
+}
+
+// lookup returns the value of client, the host:port a log was received from
+func (s *sources[T]) lookup(client string) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var zero T
+	if len(s.prefixes) == 0 {
+		return zero, false
+	}
+
+	addr, ok := clientAddr(client)
+	if !ok {
+		return zero, false
+	}
+
+	for _, p := range s.prefixes {
+		if p.prefix.Contains(addr) {
+			return p.value, true
+		}
+	}
+
+	return zero, false
+}
+
+// lookupHostname returns the value of hostname, the case is ignored
+func (s *sources[T]) lookupHostname(hostname []byte) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.hostnames) == 0 || len(hostname) == 0 {
+		var zero T
+		return zero, false
+	}
+
+	if value, ok := s.hostnames[string(hostname)]; ok {
+		return value, true
+	}
+
+	value, ok := s.hostnames[strings.ToLower(string(hostname))]
+	return value, ok
+}
+
+// clientAddr returns the IP of client, either host:port or an IP
+func clientAddr(client string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(client); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+
+	if addr, err := netip.ParseAddr(client); err == nil {
+		return addr.Unmap(), true
+	}
+
+	return netip.Addr{}, false
+}
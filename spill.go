@@ -0,0 +1,307 @@
+package gsyslog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/crazy-airhead/gsyslog/parser"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	ErrSpillCorrupted = errors.New("spill file corrupted")
+)
+
+// maxSpillField bounds the length of a field read back from a spill file
+const maxSpillField = 64 * 1024 * 1024
+
+// spillSegment is a spill file, written then replayed once
+type spillSegment struct {
+	path    string
+	records int
+}
+
+// spill is a backlog kept in files. Tasks are appended to the current segment,
+// which is closed and replayed from the start once the older ones are drained.
+//
+// Record layout, lengths and numbers are varints:
+//
+//	len listener | len client | len subject | has cred [pid uid gid] |
+//	received unix nano | conn id | len local | len data
+type spill struct {
+	dir    string
+	lookup func(name string) *Listener
+	seq    int
+
+	// segments waiting to be replayed, oldest first, the last one is being written
+	segments  []*spillSegment
+	writeFile *os.File
+	writer    *bufio.Writer
+	readFile  *os.File
+	reader    *bufio.Reader
+	size      int
+	// buf the scratch buffer the records are encoded to
+	buf []byte
+}
+
+func newSpill(dir string, lookup func(name string) *Listener) *spill {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	return &spill{
+		dir:    dir,
+		lookup: lookup,
+	}
+}
+
+func (s *spill) push(t *task) (*task, error) {
+	if s.writer == nil {
+		if err := s.create(); err != nil {
+			return nil, err
+		}
+	}
+
+	buf := appendSpillField(s.buf[:0], []byte(t.listener.Name()))
+	buf = appendSpillField(buf, []byte(t.client))
+
+	var cred *parser.Credential
+	var subject string
+	var id uint64
+	if t.ctx != nil {
+		cred, subject, id = t.ctx.cred, t.ctx.subject, t.ctx.id
+	}
+
+	buf = appendSpillField(buf, []byte(subject))
+	if cred != nil {
+		buf = append(buf, 1)
+		buf = binary.AppendVarint(buf, int64(cred.Pid))
+		buf = binary.AppendVarint(buf, int64(cred.Uid))
+		buf = binary.AppendVarint(buf, int64(cred.Gid))
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = binary.AppendVarint(buf, t.received.UnixNano())
+	buf = binary.AppendUvarint(buf, id)
+	buf = appendSpillField(buf, []byte(t.local))
+	buf = appendSpillField(buf, t.data)
+	s.buf = buf
+
+	if _, err := s.writer.Write(buf); err != nil {
+		return nil, err
+	}
+
+	s.segments[len(s.segments)-1].records++
+	s.size++
+
+	return nil, nil
+}
+
+func (s *spill) pop() (*task, int, error) {
+	for s.size > 0 {
+		if s.reader == nil {
+			if err := s.open(); err != nil {
+				return nil, s.discard(), err
+			}
+		}
+
+		segment := s.segments[0]
+		if segment.records == 0 {
+			s.remove()
+			continue
+		}
+
+		t, err := s.read()
+		if err != nil {
+			return nil, s.discard(), err
+		}
+
+		segment.records--
+		s.size--
+		if segment.records == 0 {
+			s.remove()
+		}
+
+		if t.listener == nil {
+			return nil, 1, fmt.Errorf("unknown listener of spilled message from %s", t.client)
+		}
+
+		return t, 0, nil
+	}
+
+	return nil, 0, nil
+}
+
+func (s *spill) len() int {
+	return s.size
+}
+
+// create starts a new segment to write to
+func (s *spill) create() error {
+	s.seq++
+	path := filepath.Join(s.dir, fmt.Sprintf("gsyslog-%d-%06d.spill", os.Getpid(), s.seq))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	s.writeFile = file
+	s.writer = bufio.NewWriter(file)
+	s.segments = append(s.segments, &spillSegment{path: path})
+
+	return nil
+}
+
+// open opens the oldest segment for replay, the segment being written is
+// closed first so that new tasks go to a new segment
+func (s *spill) open() error {
+	if len(s.segments) == 1 && s.writer != nil {
+		err := s.writer.Flush()
+		if e := s.writeFile.Close(); err == nil {
+			err = e
+		}
+
+		s.writeFile = nil
+		s.writer = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(s.segments[0].path)
+	if err != nil {
+		return err
+	}
+
+	s.readFile = file
+	s.reader = bufio.NewReader(file)
+
+	return nil
+}
+
+// remove deletes the replayed segment
+func (s *spill) remove() {
+	if s.reader != nil {
+		_ = s.readFile.Close()
+		s.readFile = nil
+		s.reader = nil
+	}
+
+	_ = os.Remove(s.segments[0].path)
+	s.segments = s.segments[1:]
+}
+
+// discard drops the unreadable segment, returning how many tasks were lost
+func (s *spill) discard() int {
+	lost := s.segments[0].records
+	s.size -= lost
+	s.segments[0].records = 0
+
+	if s.reader == nil && len(s.segments) == 1 {
+		// the segment being written could not be closed
+		if s.writeFile != nil {
+			_ = s.writeFile.Close()
+		}
+		s.writeFile = nil
+		s.writer = nil
+	}
+
+	s.remove()
+
+	return lost
+}
+
+func (s *spill) read() (*task, error) {
+	listener, err := readSpillField(s.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := readSpillField(s.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := readSpillField(s.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	hasCred, err := s.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *parser.Credential
+	if hasCred == 1 {
+		var ids [3]int64
+		for i := range ids {
+			if ids[i], err = binary.ReadVarint(s.reader); err != nil {
+				return nil, err
+			}
+		}
+
+		cred = &parser.Credential{Pid: int(ids[0]), Uid: int(ids[1]), Gid: int(ids[2])}
+	}
+
+	received, err := binary.ReadVarint(s.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := binary.ReadUvarint(s.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := readSpillField(s.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := readSpillField(s.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &task{
+		listener: s.lookup(string(listener)),
+		data:     data,
+		client:   string(client),
+		received: time.Unix(0, received),
+		local:    string(local),
+	}
+	if cred != nil || len(subject) > 0 || id != 0 {
+		t.ctx = &connContext{id: id, local: string(local), cred: cred, subject: string(subject)}
+	}
+
+	return t, nil
+}
+
+func appendSpillField(buf []byte, field []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(field)))
+	return append(buf, field...)
+}
+
+func readSpillField(r *bufio.Reader) ([]byte, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if l > maxSpillField {
+		return nil, ErrSpillCorrupted
+	}
+
+	field := make([]byte, l)
+	if _, err = io.ReadFull(r, field); err != nil {
+		return nil, err
+	}
+
+	return field, nil
+}
@@ -0,0 +1,123 @@
+package gsyslog
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// drainPollInterval is how often Shutdown checks whether every message is accounted for
+const drainPollInterval = 10 * time.Millisecond
+
+// DropReason tells why a message was dropped
+type DropReason int
+
+const (
+	DropPoolFull     DropReason = iota // worker pool or ordered shard saturated, OverflowDropNewest
+	DropQueueFull                      // oldest queued message evicted, OverflowDropOldest
+	DropSpillFailed                    // message could not be written to or read from the spill files, OverflowSpill
+	DropPoolClosed                     // worker pool or ordered shards released
+	DropHandlerPanic                   // handler panicked
+	dropReasons
+)
+
+func (r DropReason) String() string {
+	switch r {
+	case DropPoolFull:
+		return "pool full"
+	case DropQueueFull:
+		return "queue full"
+	case DropSpillFailed:
+		return "spill failed"
+	case DropPoolClosed:
+		return "pool closed"
+	case DropHandlerPanic:
+		return "handler panic"
+	default:
+		return "unknown"
+	}
+}
+
+// Stats counts the messages of a Server. Every received message ends up either
+// handled, once the Handler returned, or dropped, so that after Shutdown
+// Received == Handled + Dropped.
+type Stats struct {
+	Received uint64
+	Handled  uint64
+	Dropped  uint64
+
+	// Dropped by reason
+	DroppedPoolFull     uint64
+	DroppedQueueFull    uint64
+	DroppedSpillFailed  uint64
+	DroppedPoolClosed   uint64
+	DroppedHandlerPanic uint64
+
+	// Queued counts the messages that went through the overflow queue or the spill files
+	Queued uint64
+}
+
+// Pending returns the number of messages received but neither handled nor dropped yet
+func (s Stats) Pending() uint64 {
+	return s.Received - s.Handled - s.Dropped
+}
+
+// accounting tracks every message from the moment it is received until the
+// handler returns or the message is dropped
+type accounting struct {
+	received atomic.Uint64
+	handled  atomic.Uint64
+	dropped  [dropReasons]atomic.Uint64
+	queued   atomic.Uint64
+}
+
+func (a *accounting) receive() {
+	a.received.Add(1)
+}
+
+func (a *accounting) handle() {
+	a.handled.Add(1)
+}
+
+func (a *accounting) drop(reason DropReason) {
+	a.dropped[reason].Add(1)
+}
+
+func (a *accounting) queue() {
+	a.queued.Add(1)
+}
+
+func (a *accounting) stats() Stats {
+	// load the outcomes first so that a snapshot never has more outcomes than receptions
+	stats := Stats{
+		Handled:             a.handled.Load(),
+		DroppedPoolFull:     a.dropped[DropPoolFull].Load(),
+		DroppedQueueFull:    a.dropped[DropQueueFull].Load(),
+		DroppedSpillFailed:  a.dropped[DropSpillFailed].Load(),
+		DroppedPoolClosed:   a.dropped[DropPoolClosed].Load(),
+		DroppedHandlerPanic: a.dropped[DropHandlerPanic].Load(),
+		Queued:              a.queued.Load(),
+	}
+	stats.Dropped = stats.DroppedPoolFull + stats.DroppedQueueFull + stats.DroppedSpillFailed +
+		stats.DroppedPoolClosed + stats.DroppedHandlerPanic
+	stats.Received = a.received.Load()
+
+	return stats
+}
+
+// wait blocks until every received message is handled or dropped, it returns
+// ctx.Err() when ctx is done first
+func (a *accounting) wait(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for a.stats().Pending() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package gsyslog
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// timezones resolves the timezone of the timestamps without a zone of the logs
+// of a source, see parser.TimezoneResolver
+type timezones struct {
+	// enabled once a timezone is set, the logs are parsed without a resolver
+	// until then
+	enabled  atomic.Bool
+	location atomic.Pointer[time.Location]
+	sources  sources[*time.Location]
+}
+
+// SetTimezone Sets the timezone of the timestamps without a zone of the logs of
+// the sources without their own timezone, e.g. time.Local. The parser's own,
+// UTC, is used by default. It may be set while serving.
+func (s *Server) SetTimezone(location *time.Location) {
+	s.timezones.location.Store(location)
+	s.timezones.enabled.Store(true)
+}
+
+// SetSourceTimezone Sets the timezone of the timestamps without a zone of the
+// logs of source, an IP, a CIDR or a hostname, e.g. "192.0.2.0/24" or "fw01".
+// The hostname of the log wins over its address, the longest matching CIDR
+// over the others. It may be set while serving.
+func (s *Server) SetSourceTimezone(source string, location *time.Location) error {
+	if isHostname(source) {
+		s.timezones.sources.setHostname(source, location)
+	} else if err := s.timezones.sources.set(source, location); err != nil {
+		return err
+	}
+
+	s.timezones.enabled.Store(true)
+	return nil
+}
+
+// Timezone returns the timezone of the logs of hostname received from client,
+// nil for the parser's own
+func (t *timezones) Timezone(client string, hostname []byte) *time.Location {
+	if location, ok := t.sources.lookupHostname(hostname); ok {
+		return location
+	}
+
+	if location, ok := t.sources.lookup(client); ok {
+		return location
+	}
+
+	return t.location.Load()
+}
+
+// isHostname tells whether source is a hostname rather than an IP or a CIDR,
+// which have no letter but the hexadecimal digits of IPv6
+func isHostname(source string) bool {
+	return !strings.ContainsAny(source, ":/") && strings.IndexFunc(source, unicode.IsLetter) >= 0
+}
@@ -0,0 +1,83 @@
+package gsyslog
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_timezones(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	newYork := time.FixedZone("EST", -5*60*60)
+	berlin := time.FixedZone("CET", 60*60)
+
+	handler := &cloneHandler{}
+	server := NewServer()
+	server.SetHandler(handler)
+	server.SetCodec(RFC3164Codec)
+	server.SetTimezone(tokyo)
+
+	if err := server.SetSourceTimezone("192.0.2.0/24", newYork); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.SetSourceTimezone("FW01", berlin); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.SetSourceTimezone("192.0.2.300", berlin); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	listener := NewListener("udp://127.0.0.1:0")
+	server.AddListener(listener)
+
+	fixtures := []struct {
+		client   string
+		body     string
+		location *time.Location
+		// hour in location
+		hour int
+	}{
+		{"192.0.2.1:514", "<34>Oct 11 22:14:15 host su: source", newYork, 22},
+		{"198.51.100.1:514", "<34>Oct 11 22:14:15 host su: default", tokyo, 22},
+		// the hostname wins over the address, whatever its case
+		{"192.0.2.1:514", "<34>Oct 11 22:14:15 fw01 su: hostname", berlin, 22},
+		// the timestamps with a zone are kept
+		{"192.0.2.1:514", "<34>2003-10-11T22:14:15Z host su: zone", time.UTC, 22},
+		{"192.0.2.1:514", "<34>Oct 11 22:14:15 UTC host su: name", time.UTC, 22},
+	}
+
+	for _, fixture := range fixtures {
+		server.dispatch(&task{listener: listener, data: []byte(fixture.body), client: fixture.client})
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handler.logs) != len(fixtures) {
+		t.Fatalf("unexpected %d logs", len(handler.logs))
+	}
+
+	for _, fixture := range fixtures {
+		found := false
+		for _, log := range handler.logs {
+			if string(log.Body) != fixture.body {
+				continue
+			}
+
+			found = true
+			ts := log.Syslog.Timestamp
+			_, offset := ts.Zone()
+			_, expected := ts.In(fixture.location).Zone()
+			if ts.Hour() != fixture.hour || offset != expected {
+				t.Fatalf("unexpected timestamp %s of %q", ts, fixture.body)
+			}
+		}
+
+		if !found {
+			t.Fatalf("log %q not handled", fixture.body)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package gsyslog
+
+import (
+	"crypto/tls"
+	"errors"
+	"github.com/panjf2000/gnet/v2/pkg/logging"
+	"net"
+	"strings"
+	"time"
+)
+
+// RFC5425: https://www.ietf.org/rfc/rfc5425.txt - syslog over TLS
+
+var (
+	ErrNoTLSConfig = errors.New("tls config is required for the tls:// scheme")
+)
+
+const tlsReadSize = 64 * 1024
+
+// DefaultTLSHandshakeTimeout is how long a client has to complete the TLS
+// handshake, see SetTLSHandshakeTimeout
+const DefaultTLSHandshakeTimeout = 10 * time.Second
+
+// SetTLSConfig Sets the TLS config used by the tls:// scheme. Mutual TLS is enabled
+// by the config itself, e.g. with ClientAuth set to tls.RequireAndVerifyClientCert
+// and ClientCAs holding the trusted client CAs.
+func (l *Listener) SetTLSConfig(config *tls.Config) {
+	l.tlsConfig = config
+}
+
+// SetTLSHandshakeTimeout Sets how long a client of the tls:// scheme has to
+// complete the handshake before it is closed, DefaultTLSHandshakeTimeout by
+// default. It is not limited when negative.
+func (l *Listener) SetTLSHandshakeTimeout(timeout time.Duration) {
+	l.tlsHandshakeTimeout = timeout
+}
+
+func (l *Listener) handshakeTimeout() time.Duration {
+	if l.tlsHandshakeTimeout == 0 {
+		return DefaultTLSHandshakeTimeout
+	}
+
+	return l.tlsHandshakeTimeout
+}
+
+func (l *Listener) bindTLS() error {
+	if l.tlsConfig == nil {
+		return ErrNoTLSConfig
+	}
+
+	ln, err := tls.Listen("tcp", strings.TrimPrefix(l.addr, "tls://"), l.tlsConfig)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	if l.stopped {
+		l.mu.Unlock()
+		_ = ln.Close()
+		return ErrListenerStopped
+	}
+
+	l.tlsListener = ln
+	l.tlsConns = make(map[net.Conn]struct{})
+	l.mu.Unlock()
+
+	logging.Infof("syslog server is listening on %s\n", l.addr)
+
+	l.run(func() error {
+		return l.acceptTLS(ln)
+	})
+
+	return nil
+}
+
+// acceptTLS serves every connection until the listener is closed, then waits
+// for the connections to be closed
+func (l *Listener) acceptTLS(ln net.Listener) error {
+	defer l.wg.Wait()
+
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		l.wg.Add(1)
+		go l.serveTLS(c.(*tls.Conn))
+	}
+}
+
+func (l *Listener) stopTLS() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.tlsListener == nil {
+		return
+	}
+
+	_ = l.tlsListener.Close()
+	for c := range l.tlsConns {
+		_ = c.Close()
+	}
+}
+
+func (l *Listener) serveTLS(c *tls.Conn) {
+	defer l.wg.Done()
+
+	l.mu.Lock()
+	if l.stopped {
+		l.mu.Unlock()
+		_ = c.Close()
+		return
+	}
+
+	l.tlsConns[c] = struct{}{}
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		delete(l.tlsConns, c)
+		l.mu.Unlock()
+
+		_ = c.Close()
+	}()
+
+	// a client that never completes the handshake would hold the connection
+	if timeout := l.handshakeTimeout(); timeout > 0 {
+		_ = c.SetDeadline(time.Now().Add(timeout))
+	}
+
+	if err := c.Handshake(); err != nil {
+		logging.Errorf("syslog tls handshake with %s failed, closing the connection, error:%v", c.RemoteAddr(), err)
+		return
+	}
+
+	_ = c.SetDeadline(time.Time{})
+
+	subject := ""
+	if certs := c.ConnectionState().PeerCertificates; len(certs) > 0 {
+		subject = certs[0].Subject.String()
+	}
+
+	conn := newStreamConn(c)
+	conn.SetContext(&connContext{id: l.server.connIDs.Add(1), local: c.LocalAddr().String(), subject: subject})
+	client := c.RemoteAddr().String()
+	buf := make([]byte, tlsReadSize)
+	for {
+		n, err := c.Read(buf)
+		if n > 0 {
+			conn.fill(buf[:n])
+			err := l.decode(conn, func(data []byte) {
+				l.dispatch(data, client, conn.Context().(*connContext))
+			})
+			if err != nil {
+				logging.Errorf("syslog decode from %s failed, closing the connection, error:%v", client, err)
+				return
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
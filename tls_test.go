@@ -0,0 +1,160 @@
+package gsyslog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/crazy-airhead/gsyslog/parser"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+type chanHandler chan *parser.Log
+
+func (h chanHandler) Handle(log *parser.Log) {
+	h <- log
+}
+
+// newTestCert issues a certificate for cn, self-signed when ca is nil
+func newTestCert(t *testing.T, cn string, ca *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  ca == nil,
+	}
+
+	parent, signer := tmpl, any(key)
+	if ca != nil {
+		parent, signer = ca.Leaf, ca.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+}
+
+func Test_tls_server(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	serverCert := newTestCert(t, "syslog server", &ca)
+	clientCert := newTestCert(t, "syslog client", &ca)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	handler := make(chanHandler, 1)
+	server := NewServer()
+	server.SetCodec(RFC3164Codec)
+	server.SetHandler(handler)
+	server.SetAddr("tls://127.0.0.1:16514")
+	server.SetTLSConfig(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	go func() {
+		_ = server.Boot()
+	}()
+	defer func(server *Server) {
+		_ = server.Stop()
+	}(server)
+
+	var conn *tls.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		conn, err = tls.Dial("tcp", "127.0.0.1:16514", &tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+			RootCAs:      pool,
+		})
+		if err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("<34>Oct 11 22:14:15 mymachine su: 'su root' failed\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case log := <-handler:
+		if got := log.GetString("peerSubject"); got != "CN=syslog client" {
+			t.Fatalf("unexpected peer subject %q", got)
+		}
+		if got := log.GetString("content"); got != "'su root' failed" {
+			t.Fatalf("unexpected content %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no log received")
+	}
+}
+
+func Test_tls_handshake_timeout(t *testing.T) {
+	serverCert := newTestCert(t, "syslog server", nil)
+
+	server := NewServer()
+	server.SetCodec(RFC3164Codec)
+	server.SetHandler(make(chanHandler, 1))
+	server.SetAddr("tls://127.0.0.1:16515")
+	server.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{serverCert}})
+	server.SetTLSHandshakeTimeout(100 * time.Millisecond)
+	go func() {
+		_ = server.Boot()
+	}()
+	defer func(server *Server) {
+		_ = server.Stop()
+	}(server)
+
+	var conn net.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		conn, err = net.Dial("tcp", "127.0.0.1:16515")
+		if err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the client never starts the handshake, the server closes the connection
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("unexpected data from the server")
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("connection closed after %s", elapsed)
+	}
+}
@@ -0,0 +1,161 @@
+package gsyslog
+
+import (
+	"errors"
+	"github.com/panjf2000/gnet/v2/pkg/logging"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotSocket = errors.New("path exists and is not a unix socket")
+	// ErrUnixPathCase gnet lower-cases the whole address, so unix:// paths must be lower case
+	ErrUnixPathCase = errors.New("unix stream socket path must be lower case")
+)
+
+const unixgramReadSize = 64 * 1024
+
+// SetUnixSocketMode Sets the permissions of the unix socket file, e.g. 0666 for /dev/log
+func (l *Listener) SetUnixSocketMode(mode os.FileMode) {
+	l.unixMode = mode
+}
+
+// SetUnixSocketOwner Sets the owner and group of the unix socket file, -1 keeps the current one
+func (l *Listener) SetUnixSocketOwner(uid int, gid int) {
+	l.unixUid = uid
+	l.unixGid = gid
+	l.unixChown = true
+}
+
+// unixPath returns the socket path of the unix:// and unixgram:// schemes
+func (l *Listener) unixPath() string {
+	return strings.TrimPrefix(strings.TrimPrefix(l.addr, "unixgram://"), "unix://")
+}
+
+// removeStaleSocket removes a socket file left behind by a previous process,
+// any other kind of file is kept and reported
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return ErrNotSocket
+	}
+
+	return os.Remove(path)
+}
+
+// setupUnixSocket applies the configured permissions and ownership to the socket file
+func (l *Listener) setupUnixSocket(path string) error {
+	if l.unixMode != 0 {
+		if err := os.Chmod(path, l.unixMode); err != nil {
+			return err
+		}
+	}
+
+	if l.unixChown {
+		if err := os.Chown(path, l.unixUid, l.unixGid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *Listener) bindUnixgram() error {
+	path := l.unixPath()
+	if err := removeStaleSocket(path); err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+
+	if err = l.setupUnixSocket(path); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	if err = enablePassCred(conn); err != nil {
+		logging.Errorf("syslog can not receive peer credentials on %s, error:%v", path, err)
+	}
+
+	if l.server.bufferSize > 0 {
+		_ = conn.SetReadBuffer(l.server.bufferSize)
+	}
+
+	l.mu.Lock()
+	if l.stopped {
+		l.mu.Unlock()
+		_ = conn.Close()
+		_ = removeStaleSocket(path)
+		return ErrListenerStopped
+	}
+
+	l.unixgramConn = conn
+	l.local = path
+	l.mu.Unlock()
+
+	logging.Infof("syslog server is listening on %s\n", l.addr)
+
+	l.run(func() error {
+		return l.readUnixgram(conn)
+	})
+
+	return nil
+}
+
+// readUnixgram serves every datagram until the socket is closed
+func (l *Listener) readUnixgram(conn *net.UnixConn) error {
+	buf := make([]byte, unixgramReadSize)
+	oob := make([]byte, credOOBSize)
+	for {
+		n, oobn, _, addr, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		client := ""
+		if addr != nil {
+			client = addr.Name
+		}
+
+		received := time.Now()
+		data, pooled := l.server.copyDatagram(buf[:n])
+		l.server.dispatch(&task{
+			listener: l,
+			data:     data,
+			client:   client,
+			ctx:      &connContext{cred: parseCred(oob[:oobn])},
+			buf:      pooled,
+			received: received,
+			local:    l.local,
+		})
+	}
+}
+
+func (l *Listener) stopUnixgram() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.unixgramConn == nil {
+		return
+	}
+
+	_ = l.unixgramConn.Close()
+	_ = removeStaleSocket(l.unixPath())
+}
@@ -0,0 +1,145 @@
+package gsyslog
+
+import (
+	"github.com/crazy-airhead/gsyslog/parser"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitLog(t *testing.T, handler chanHandler) *parser.Log {
+	select {
+	case log := <-handler:
+		return log
+	case <-time.After(5 * time.Second):
+		t.Fatal("no log received")
+	}
+
+	return nil
+}
+
+func dialRetry(t *testing.T, network string, addr string) net.Conn {
+	var conn net.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		conn, err = net.Dial(network, addr)
+		if err == nil {
+			return conn
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatal(err)
+	return nil
+}
+
+func assertPeerCred(t *testing.T, log *parser.Log) {
+	cred, ok := log.Get("peerCred").(parser.Credential)
+	if !ok {
+		t.Fatalf("no peer credentials in %v", log.Header)
+	}
+
+	if cred.Pid != os.Getpid() || cred.Uid != os.Getuid() || cred.Gid != os.Getgid() {
+		t.Fatalf("unexpected peer credentials %+v", cred)
+	}
+}
+
+func Test_unixgram_server(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+
+	// stale socket left behind by a previous process
+	stale, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = stale.Close()
+
+	handler := make(chanHandler, 1)
+	server := NewServer()
+	server.SetHandler(handler)
+	server.SetAddr("unixgram://" + path)
+	server.SetUnixSocketMode(0666)
+	go func() {
+		_ = server.Boot()
+	}()
+
+	conn := dialRetry(t, "unixgram", path)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("<13>Oct 11 22:14:15 myprog: hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := waitLog(t, handler)
+	if got := log.GetString("content"); got != "hello" {
+		t.Fatalf("unexpected content %q", got)
+	}
+	assertPeerCred(t, log)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0666 {
+		t.Fatalf("unexpected socket mode %v", info.Mode())
+	}
+
+	_ = server.Stop()
+	if _, err = os.Lstat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket file not removed on stop, error:%v", err)
+	}
+}
+
+func Test_unix_server(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gsyslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+
+	handler := make(chanHandler, 1)
+	server := NewServer()
+	server.SetHandler(handler)
+	server.SetAddr("unix://" + path)
+	go func() {
+		_ = server.Boot()
+	}()
+	defer func(server *Server) {
+		_ = server.Stop()
+	}(server)
+
+	conn := dialRetry(t, "unix", path)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("<13>Oct 11 22:14:15 myprog: hello\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := waitLog(t, handler)
+	if got := log.GetString("content"); got != "hello" {
+		t.Fatalf("unexpected content %q", got)
+	}
+	assertPeerCred(t, log)
+}
+
+func Test_unix_server_not_socket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	if err := os.WriteFile(path, []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer()
+	server.SetAddr("unixgram://" + path)
+	if err := server.Boot(); err != ErrNotSocket {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "keep me" {
+		t.Fatal("regular file was removed")
+	}
+}